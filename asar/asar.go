@@ -17,6 +17,7 @@
 package asar
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
@@ -60,6 +61,12 @@ func align4(n int64) int64 {
 // Extract unpacks the asar archive at asarPath into destDir. Files marked
 // "unpacked" are copied from the sibling "<asarPath>.unpacked" directory.
 func Extract(asarPath, destDir string) error {
+	return ExtractContext(context.Background(), asarPath, destDir)
+}
+
+// ExtractContext is like Extract but stops between entries once ctx is done,
+// returning ctx.Err(). destDir is left partially populated in that case.
+func ExtractContext(ctx context.Context, asarPath, destDir string) error {
 	f, err := os.Open(asarPath)
 	if err != nil {
 		return fmt.Errorf("opening asar: %w", err)
@@ -92,11 +99,14 @@ func Extract(asarPath, destDir string) error {
 	if err := os.MkdirAll(destDir, 0755); err != nil {
 		return err
 	}
-	return extractEntry(&root, f, contentBase, destDir, destDir, unpackedDir)
+	return extractEntry(ctx, &root, f, contentBase, destDir, destDir, unpackedDir)
 }
 
-func extractEntry(e *entry, archive *os.File, contentBase int64, destDir, curDir, unpackedDir string) error {
+func extractEntry(ctx context.Context, e *entry, archive *os.File, contentBase int64, destDir, curDir, unpackedDir string) error {
 	for name, child := range e.Files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		dst, err := safeJoin(destDir, curDir, name)
 		if err != nil {
 			return err
@@ -107,7 +117,7 @@ func extractEntry(e *entry, archive *os.File, contentBase int64, destDir, curDir
 			if err := os.MkdirAll(dst, 0755); err != nil {
 				return err
 			}
-			if err := extractEntry(child, archive, contentBase, destDir, dst, unpackedDir); err != nil {
+			if err := extractEntry(ctx, child, archive, contentBase, destDir, dst, unpackedDir); err != nil {
 				return err
 			}
 
@@ -207,6 +217,25 @@ type packFile struct {
 // Pack builds an asar archive at asarPath from the contents of srcDir. Every
 // regular file is inlined into the archive (nothing is left "unpacked").
 func Pack(srcDir, asarPath string) error {
+	return PackContext(context.Background(), srcDir, asarPath)
+}
+
+// PackContext is like Pack but stops between files once ctx is done, returning
+// ctx.Err(). The archive is written to a temporary file and only renamed into
+// place on success, so a cancelled pack never leaves a partial asarPath behind.
+func PackContext(ctx context.Context, srcDir, asarPath string) error {
+	return PackWithOptions(ctx, srcDir, asarPath, PackOptions{})
+}
+
+// PackOptions controls PackWithOptions.
+type PackOptions struct {
+	// OnProgress, if set, is called after each file is written with the number of
+	// files written so far and the total.
+	OnProgress func(done, total int)
+}
+
+// PackWithOptions is PackContext with options.
+func PackWithOptions(ctx context.Context, srcDir, asarPath string, opts PackOptions) error {
 	root := &entry{Files: map[string]*entry{}}
 	var files []packFile
 	var offset int64
@@ -215,6 +244,9 @@ func Pack(srcDir, asarPath string) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if path == srcDir {
 			return nil
 		}
@@ -298,7 +330,11 @@ func Pack(srcDir, asarPath string) error {
 			return err
 		}
 	}
-	for _, pf := range files {
+	for i, pf := range files {
+		if err := ctx.Err(); err != nil {
+			tmp.Close()
+			return err
+		}
 		in, err := os.Open(pf.diskPath)
 		if err != nil {
 			tmp.Close()
@@ -310,6 +346,9 @@ func Pack(srcDir, asarPath string) error {
 			return err
 		}
 		in.Close()
+		if opts.OnProgress != nil {
+			opts.OnProgress(i+1, len(files))
+		}
 	}
 	if err := tmp.Close(); err != nil {
 		return err
@@ -2,8 +2,10 @@ package asar
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -139,3 +141,45 @@ func TestPathTraversalRejected(t *testing.T) {
 		t.Errorf("expected valid name to be accepted, got %v", err)
 	}
 }
+
+// TestPackCancelled verifies a cancelled pack returns the context error and leaves
+// no archive behind.
+func TestPackCancelled(t *testing.T) {
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "index.js"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	archive := filepath.Join(t.TempDir(), "test.asar")
+	if err := PackContext(ctx, src, archive); !errors.Is(err, context.Canceled) {
+		t.Fatalf("PackContext: got %v, want context.Canceled", err)
+	}
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Errorf("archive exists after cancelled pack (stat err %v)", err)
+	}
+}
+
+// TestPackProgress verifies OnProgress is called once per file, ending at the total.
+func TestPackProgress(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{"a.js", "b.js", "c.js"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var calls [][2]int
+	opts := PackOptions{OnProgress: func(done, total int) {
+		calls = append(calls, [2]int{done, total})
+	}}
+	archive := filepath.Join(t.TempDir(), "test.asar")
+	if err := PackWithOptions(context.Background(), src, archive, opts); err != nil {
+		t.Fatalf("PackWithOptions: %v", err)
+	}
+	if len(calls) != 3 || calls[2] != [2]int{3, 3} {
+		t.Errorf("progress calls: got %v", calls)
+	}
+}
@@ -256,6 +256,25 @@ if ($arm64Bundle -and (Test-Path $arm64Bundle)) {
     Remove-Item ".\builds\Uninstall.command" -ErrorAction SilentlyContinue
 }
 
+# Signed checksums, which the launcher verifies before installing a self-update
+Write-Host "`nWriting checksums..."
+Remove-Item ".\builds\checksums.txt", ".\builds\checksums.txt.sig" -ErrorAction SilentlyContinue
+wsl sh -c "cd '$currentDirWSL/builds' && sha256sum *.zip > checksums.txt"
+if ($env:RELEASE_SIGNING_KEY) {
+    $keyWSL = ConvertTo-WSLPath $env:RELEASE_SIGNING_KEY
+    wsl sh -c "cd '$currentDirWSL/builds' && openssl pkeyutl -sign -inkey '$keyWSL' -rawin -in checksums.txt -out checksums.sig.bin && base64 < checksums.sig.bin | tr -d '\n' > checksums.txt.sig; status=`$?; rm -f checksums.sig.bin; exit `$status"
+    if ($LASTEXITCODE -eq 0) {
+        Write-Host "Signed: builds\checksums.txt.sig" -ForegroundColor Green
+    }
+    else {
+        Remove-Item ".\builds\checksums.txt.sig" -ErrorAction SilentlyContinue
+        Write-Host "Signing checksums.txt failed!" -ForegroundColor Red
+    }
+}
+else {
+    Write-Host "RELEASE_SIGNING_KEY is not set, so checksums.txt is unsigned and launchers won't install this release as an update" -ForegroundColor Red
+}
+
 # Summary
 Write-Host "`nBuilds complete!" -ForegroundColor Green
 if (Test-Path ".\builds\$APP_NAME-$VERSION-windows.zip") {
@@ -267,3 +286,6 @@ if (Test-Path ".\builds\$APP_NAME-$VERSION-macos-amd64.zip") {
 if (Test-Path ".\builds\$APP_NAME-$VERSION-macos-arm64.zip") {
     Write-Host "- macOS ARM64: builds\$APP_NAME-$VERSION-macos-arm64.zip" -ForegroundColor White
 }
+if (Test-Path ".\builds\checksums.txt.sig") {
+    Write-Host "- Checksums: builds\checksums.txt, builds\checksums.txt.sig (upload both with the zips)" -ForegroundColor White
+}
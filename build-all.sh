@@ -17,7 +17,7 @@ echo "============================================"
 mkdir -p builds
 
 # Clean up any existing files
-rm -f builds/*.zip
+rm -f builds/*.zip builds/checksums.txt builds/checksums.txt.sig
 rm -rf builds/*.app
 
 # Function to create macOS app bundle
@@ -181,6 +181,26 @@ else
     echo "  ❌ Windows build failed!"
 fi
 
+# Signed checksums, which the launcher verifies before installing a self-update
+echo ""
+echo "Writing checksums..."
+if command -v sha256sum > /dev/null; then
+    (cd builds && sha256sum *.zip > checksums.txt)
+else
+    (cd builds && shasum -a 256 *.zip > checksums.txt)
+fi
+if [ -n "$RELEASE_SIGNING_KEY" ]; then
+    if openssl pkeyutl -sign -inkey "$RELEASE_SIGNING_KEY" -rawin -in builds/checksums.txt -out builds/checksums.sig.bin; then
+        base64 < builds/checksums.sig.bin | tr -d '\n' > builds/checksums.txt.sig
+        echo "  ✅ Signed: builds/checksums.txt.sig"
+    else
+        echo "  ❌ Signing checksums.txt failed!"
+    fi
+    rm -f builds/checksums.sig.bin
+else
+    echo "  ❌ RELEASE_SIGNING_KEY is not set, so checksums.txt is unsigned and launchers won't install this release as an update"
+fi
+
 # Summary
 echo ""
 echo "============================================"
@@ -199,5 +219,9 @@ if [ -f "builds/$APP_NAME-$VERSION-windows.zip" ]; then
     echo "✅ Windows: builds/$APP_NAME-$VERSION-windows.zip"
 fi
 
+if [ -f "builds/checksums.txt.sig" ]; then
+    echo "✅ Checksums: builds/checksums.txt, builds/checksums.txt.sig (upload both with the zips)"
+fi
+
 echo ""
 echo "All builds complete! 🎉"
@@ -0,0 +1,91 @@
+// Package config loads the launcher's user-editable settings. They live in
+// config.json next to the launcher; missing keys keep their defaults.
+package config
+
+import (
+	"claude-webext-patcher/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Polyfills toggles the wrapper's console-message polyfills for Electron-hosted extensions.
+type Polyfills struct {
+	Alarms        bool `json:"alarms"`
+	Notifications bool `json:"notifications"`
+	TabEvents     bool `json:"tab_events"`
+}
+
+type Config struct {
+	// DefaultInstance is the instance used when --instance is not given.
+	DefaultInstance string `json:"default_instance"`
+	// SentinelMaxReloads is how many times the wrapper reloads claude.ai when the
+	// sentinel content script doesn't report in.
+	SentinelMaxReloads int `json:"sentinel_max_reloads"`
+	// SentinelTimeoutMS is how long the wrapper waits for the sentinel before reloading.
+	SentinelTimeoutMS int `json:"sentinel_timeout_ms"`
+	// ClearCache clears the session caches on every launch, which keeps extension
+	// updates from being masked by stale service workers.
+	ClearCache bool      `json:"clear_cache"`
+	Polyfills  Polyfills `json:"polyfills"`
+	// LockedExtensions installs exactly the extension versions recorded in
+	// extensions.lock instead of the latest releases.
+	LockedExtensions bool `json:"locked_extensions"`
+	// Beta also offers prerelease versions of extensions and of the launcher itself.
+	Beta bool `json:"beta"`
+	// Themes maps instance names to the theme (a .css file in the themes folder,
+	// without the extension) applied to them. --theme overrides it.
+	Themes map[string]string `json:"themes"`
+}
+
+// Default returns the built-in configuration.
+func Default() *Config {
+	return &Config{
+		DefaultInstance:    "modified",
+		SentinelMaxReloads: 2,
+		SentinelTimeoutMS:  5000,
+		ClearCache:         true,
+		Polyfills: Polyfills{
+			Alarms:        true,
+			Notifications: true,
+			TabEvents:     true,
+		},
+	}
+}
+
+// Theme returns the theme configured for instance, or "" for none.
+func (c *Config) Theme(instance string) string {
+	return c.Themes[instance]
+}
+
+// Path returns the location of config.json.
+func Path() string {
+	return utils.ResolvePath("config.json")
+}
+
+// Load reads config.json over the defaults. A missing file yields the defaults;
+// an unreadable one is reported and ignored.
+func Load() *Config {
+	cfg := Default()
+	data, err := os.ReadFile(Path())
+	if err != nil {
+		return cfg
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		fmt.Printf("Warning: could not parse %s, using defaults: %v\n", Path(), err)
+		return Default()
+	}
+	if cfg.DefaultInstance == "" {
+		cfg.DefaultInstance = Default().DefaultInstance
+	}
+	return cfg
+}
+
+// Save writes the configuration to config.json.
+func (c *Config) Save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(Path(), data, 0644)
+}
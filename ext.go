@@ -0,0 +1,348 @@
+package main
+
+import (
+	"claude-webext-patcher/config"
+	"claude-webext-patcher/extensions"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const extUsage = `Usage: %s ext <command> [arguments]
+
+Commands:
+  list                                  List installed and registered extensions
+  add [--folder name] [--asset-pattern re] [--version-url url] [--public-key key]
+      <source|url|path>
+                                        Install an extension. Sources are kept up to date:
+                                          owner/repo, github:owner/repo,
+                                          gitea:https://host/owner/repo,
+                                          gitlab:https://host/group/project,
+                                          url:https://host/ext.zip (with --version-url),
+                                          local:/path/to/folder-or.zip
+  remove <folder>                       Delete an extension
+  enable <folder>                       Load an extension again
+  disable <folder>                      Keep an extension on disk but don't load or update it
+  adopt <folder>                        Let the launcher update an extension it didn't install
+  rollback <folder>                     Swap an extension with the version its last update replaced
+  dev [--folder name] <path>            Link an extension under development and reload it on every change
+  userscripts [--watch]                 Regenerate the userscript extensions; with --watch, keep them
+                                        in sync and reload them in running instances
+  lint <path|folder>                    Check an extension's API usage against what Claude Desktop supports
+  adapt <src> <dst>                     Convert a Chrome extension (folder, zip or crx) into one
+                                        Claude Desktop can load; install dst with "ext add"
+  instance <name>                       Show which extensions an instance loads
+  instance <name> add|remove <folder>...
+                                        Load only these extensions in an instance
+  instance <name> reset                 Load every extension in an instance again
+  lock                                  Pin every extension to its latest release in extensions.lock
+  status [instance]                     Show which extensions loaded on an instance's last launch
+`
+
+// runExtCommand implements the "ext" subcommands and returns the process exit code.
+// Commands that change web-extensions or extensions.json run with install access,
+// which on Windows means re-running elevated.
+func runExtCommand(ctx context.Context, args []string) int {
+	// --elevated is added when the command re-runs itself through UAC; the new
+	// console window closes on exit, so wait for the user before returning.
+	if len(args) > 0 && args[0] == "--elevated" {
+		args = args[1:]
+		defer func() {
+			fmt.Println("Press Enter to exit...")
+			fmt.Scanln()
+		}()
+		// --cwd carries the working directory of the unelevated command.
+		if len(args) > 1 && args[0] == "--cwd" {
+			if err := os.Chdir(args[1]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return 1
+			}
+			args = args[2:]
+		}
+	}
+
+	if len(args) == 0 {
+		fmt.Printf(extUsage, os.Args[0])
+		return 2
+	}
+
+	var err error
+	switch cmd, rest := args[0], args[1:]; cmd {
+	case "list":
+		err = extList()
+	case "add":
+		fs := flag.NewFlagSet("ext add", flag.ContinueOnError)
+		var opts extensions.AddOptions
+		fs.StringVar(&opts.Folder, "folder", "", "Folder name in web-extensions (default: derived from the source)")
+		fs.StringVar(&opts.AssetPattern, "asset-pattern", "", "Regular expression selecting the release asset")
+		fs.StringVar(&opts.VersionURL, "version-url", "", "URL publishing the current version, for url: sources")
+		fs.StringVar(&opts.PublicKey, "public-key", "", "minisign or ed25519 public key that must sign every release")
+		positional, parseErr := parseInterspersed(fs, rest)
+		if parseErr != nil || len(positional) != 1 {
+			fmt.Printf(extUsage, os.Args[0])
+			return 2
+		}
+		err = withInstallAccess(func() error {
+			name, err := extensions.Add(ctx, positional[0], opts)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Added %s.\n", name)
+			if report, err := extensions.Lint(extensions.FolderPath(name)); err == nil {
+				extensions.PrintLintReport(os.Stdout, report)
+			}
+			return nil
+		})
+	case "remove", "enable", "disable":
+		if len(rest) != 1 {
+			fmt.Printf(extUsage, os.Args[0])
+			return 2
+		}
+		folder := rest[0]
+		err = withInstallAccess(func() error {
+			var err error
+			switch cmd {
+			case "remove":
+				err = extensions.Remove(folder)
+			case "enable":
+				err = extensions.SetEnabled(folder, true)
+			default:
+				err = extensions.SetEnabled(folder, false)
+			}
+			if err == nil {
+				fmt.Printf("%s: %sd.\n", folder, cmd)
+			}
+			return err
+		})
+	case "dev":
+		fs := flag.NewFlagSet("ext dev", flag.ContinueOnError)
+		folder := fs.String("folder", "", "Folder name in web-extensions (default: named after the path)")
+		positional, parseErr := parseInterspersed(fs, rest)
+		if parseErr != nil || len(positional) != 1 {
+			fmt.Printf(extUsage, os.Args[0])
+			return 2
+		}
+		// Runs until Ctrl-C; on Windows, in the elevated window.
+		err = withInstallAccess(func() error {
+			return extensions.Dev(ctx, positional[0], *folder)
+		})
+	case "userscripts":
+		fs := flag.NewFlagSet("ext userscripts", flag.ContinueOnError)
+		watch := fs.Bool("watch", false, "Keep syncing until Ctrl-C")
+		if fs.Parse(rest) != nil || fs.NArg() != 0 {
+			fmt.Printf(extUsage, os.Args[0])
+			return 2
+		}
+		err = withInstallAccess(func() error {
+			if *watch {
+				return extensions.WatchUserscripts(ctx)
+			}
+			return extensions.SyncUserscripts()
+		})
+	case "lint":
+		if len(rest) != 1 {
+			fmt.Printf(extUsage, os.Args[0])
+			return 2
+		}
+		dir := rest[0]
+		if info, statErr := os.Stat(dir); statErr != nil || !info.IsDir() {
+			dir = extensions.FolderPath(rest[0])
+		}
+		report, lintErr := extensions.Lint(dir)
+		if lintErr != nil {
+			fmt.Printf("Error: %v\n", lintErr)
+			return 1
+		}
+		extensions.PrintLintReport(os.Stdout, report)
+		if report.Unsupported() {
+			return 1
+		}
+		return 0
+	case "adapt":
+		if len(rest) != 2 {
+			fmt.Printf(extUsage, os.Args[0])
+			return 2
+		}
+		err = extAdapt(ctx, rest[0], rest[1])
+	case "instance":
+		if len(rest) == 0 {
+			fmt.Printf(extUsage, os.Args[0])
+			return 2
+		}
+		err = extInstance(rest[0], rest[1:])
+	case "status":
+		if len(rest) > 1 {
+			fmt.Printf(extUsage, os.Args[0])
+			return 2
+		}
+		instance := config.Load().DefaultInstance
+		if len(rest) == 1 {
+			instance = rest[0]
+		}
+		err = extStatus(instance)
+	case "lock":
+		err = withInstallAccess(func() error {
+			fmt.Println("Locking extensions...")
+			if err := extensions.Lock(ctx); err != nil {
+				return err
+			}
+			fmt.Printf("Wrote %s.\n", extensions.LockPath())
+			return nil
+		})
+	case "adopt":
+		if len(rest) != 1 {
+			fmt.Printf(extUsage, os.Args[0])
+			return 2
+		}
+		err = withInstallAccess(func() error {
+			err := extensions.Adopt(rest[0])
+			if err == nil {
+				fmt.Printf("%s: adopted.\n", rest[0])
+			}
+			return err
+		})
+	case "rollback":
+		if len(rest) != 1 {
+			fmt.Printf(extUsage, os.Args[0])
+			return 2
+		}
+		err = withInstallAccess(func() error {
+			version, err := extensions.Rollback(rest[0])
+			if err == nil {
+				fmt.Printf("%s: rolled back to %s.\n", rest[0], version)
+			}
+			return err
+		})
+	default:
+		fmt.Printf(extUsage, os.Args[0])
+		return 2
+	}
+
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// parseInterspersed parses args with fs, allowing flags before and after the
+// positional arguments, and returns the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// extAdapt runs extensions.Adapt and explains what it did and what still won't work.
+func extAdapt(ctx context.Context, src, dst string) error {
+	result, err := extensions.Adapt(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Adapted %s into %s.\n", src, dst)
+	for _, removed := range result.Removed {
+		fmt.Printf("  Removed %s\n", removed)
+	}
+	if result.ShimmedScripts > 0 {
+		fmt.Printf("  Added %s to %d content script(s)\n", extensions.ShimFile, result.ShimmedScripts)
+	}
+	for _, warning := range result.Warnings {
+		fmt.Printf("  Warning: %s\n", warning)
+	}
+	extensions.PrintLintReport(os.Stdout, result.Report)
+	return nil
+}
+
+// extInstance shows or edits an instance's extension set. The sets live next to
+// the launcher, so no install access is needed.
+func extInstance(instance string, args []string) error {
+	var err error
+	switch {
+	case len(args) == 0:
+	case args[0] == "add" && len(args) > 1:
+		err = extensions.AddToInstance(instance, args[1:]...)
+	case args[0] == "remove" && len(args) > 1:
+		err = extensions.RemoveFromInstance(instance, args[1:]...)
+	case args[0] == "reset" && len(args) == 1:
+		err = extensions.ResetInstance(instance)
+	default:
+		return fmt.Errorf("unknown instance command %q", strings.Join(args, " "))
+	}
+	if err != nil {
+		return err
+	}
+
+	folders, ok, err := extensions.InstanceExtensions(instance)
+	switch {
+	case err != nil:
+		return err
+	case !ok:
+		fmt.Printf("Instance %s loads every enabled extension.\n", instance)
+	case len(folders) == 0:
+		fmt.Printf("Instance %s loads no extensions.\n", instance)
+	default:
+		fmt.Printf("Instance %s loads: %s\n", instance, strings.Join(folders, ", "))
+	}
+	return nil
+}
+
+func extList() error {
+	infos, err := extensions.List()
+	if err != nil {
+		return err
+	}
+	if len(infos) == 0 {
+		fmt.Println("No extensions.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FOLDER\tVERSION\tORIGIN\tSOURCE\tINSTALLED\tSTATUS")
+	for _, info := range infos {
+		version, source, installed, status := info.Version, info.Source, "-", "enabled"
+		if version == "" {
+			version = "-"
+		}
+		if source == "" {
+			source = "-"
+		}
+		if !info.InstalledAt.IsZero() {
+			installed = info.InstalledAt.Local().Format("2006-01-02")
+		}
+		switch {
+		case !info.Enabled:
+			status = "disabled"
+		case !info.Installed:
+			status = "not installed"
+		case info.Incompatible:
+			status = "incompatible"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", info.Folder, version, info.Origin, source, installed, status)
+	}
+	return w.Flush()
+}
+
+func extStatus(instance string) error {
+	status, err := extensions.ReadStatus(instance)
+	if err != nil {
+		return err
+	}
+	if status == nil {
+		fmt.Printf("Instance %s hasn't reported a status yet.\n", instance)
+		return nil
+	}
+	extensions.PrintStatus(instance)
+	return nil
+}
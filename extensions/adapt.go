@@ -0,0 +1,215 @@
+package extensions
+
+import (
+	"bytes"
+	"claude-webext-patcher/protocol"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// ShimFile is the script "ext adapt" adds in front of every content script.
+const ShimFile = "launcher-shim.js"
+
+//go:embed shim.js.tmpl
+var shimTemplate string
+
+// AdaptResult describes what Adapt changed.
+type AdaptResult struct {
+	// Removed lists the manifest keys and permissions that were dropped.
+	Removed []string
+	// ShimmedScripts is the number of content_scripts entries the shim was added to.
+	ShimmedScripts int
+	// Warnings are problems Adapt couldn't fix.
+	Warnings []string
+	// Report is the lint report of the adapted extension.
+	Report *LintReport
+}
+
+// Shim renders the polyfill shim for the protocol this launcher's wrapper speaks.
+func Shim() ([]byte, error) {
+	tmpl, err := template.New(ShimFile).Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Option("missingkey=error").Parse(shimTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, protocol.Current()); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Adapt turns the Chrome extension at src (a folder, zip or CRX) into an unpacked
+// extension in dst that Claude Desktop can load: manifest keys and permissions
+// Electron doesn't support are dropped, and the generated shim is injected ahead
+// of every content script. dst must not exist yet.
+func Adapt(ctx context.Context, src, dst string) (*AdaptResult, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dst); err == nil {
+		return nil, fmt.Errorf("%s already exists", dst)
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return nil, err
+	}
+
+	result, err := func() (*AdaptResult, error) {
+		switch {
+		case info.IsDir():
+			err = copyExtensionDir(ctx, src, dst)
+		case isCRXFile(src):
+			_, err = installCRX(ctx, src, dst, "")
+		default:
+			err = extractExtensionZip(ctx, src, dst)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return adaptDir(dst)
+	}()
+	if err != nil {
+		os.RemoveAll(dst)
+		return nil, err
+	}
+	return result, nil
+}
+
+// adaptDir rewrites the manifest in dir and writes the shim next to it.
+func adaptDir(dir string) (*AdaptResult, error) {
+	manifestPath := filepath.Join(dir, "manifest.json")
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest.json: %v", err)
+	}
+	var manifest map[string]json.RawMessage
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parsing manifest.json: %v", err)
+	}
+
+	// The copy is not the launcher's to update.
+	os.Remove(filepath.Join(dir, MarkerFile))
+
+	result := &AdaptResult{}
+	for key := range unsupportedManifestKeys {
+		if _, ok := manifest[key]; ok {
+			delete(manifest, key)
+			result.Removed = append(result.Removed, key)
+		}
+	}
+	for _, key := range actionKeys {
+		if stripDefaultPopup(manifest, key) {
+			result.Removed = append(result.Removed, key+".default_popup")
+		}
+	}
+	for _, key := range []string{"permissions", "optional_permissions"} {
+		var permissions []string
+		if json.Unmarshal(manifest[key], &permissions) != nil {
+			continue
+		}
+		kept := []string{}
+		for _, p := range permissions {
+			// Polyfilled APIs need no permission, and Electron warns about it.
+			if permissionSupport(p, false) == SupportNative {
+				kept = append(kept, p)
+			} else {
+				result.Removed = append(result.Removed, fmt.Sprintf("%s %q", key, p))
+			}
+		}
+		if len(kept) != len(permissions) {
+			manifest[key], _ = json.Marshal(kept)
+		}
+	}
+	sort.Strings(result.Removed)
+
+	var contentScripts []map[string]json.RawMessage
+	json.Unmarshal(manifest["content_scripts"], &contentScripts)
+	for _, cs := range contentScripts {
+		var js []string
+		if json.Unmarshal(cs["js"], &js) != nil || len(js) == 0 || js[0] == ShimFile {
+			continue
+		}
+		cs["js"], _ = json.Marshal(append([]string{ShimFile}, js...))
+		result.ShimmedScripts++
+	}
+	if result.ShimmedScripts > 0 {
+		manifest["content_scripts"], _ = json.Marshal(contentScripts)
+		shim, err := Shim()
+		if err != nil {
+			return nil, fmt.Errorf("rendering shim: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, ShimFile), shim, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	out, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(manifestPath, out, 0644); err != nil {
+		return nil, err
+	}
+
+	if result.Report, err = Lint(dir); err != nil {
+		return nil, err
+	}
+	background := backgroundScripts(manifest)
+	for _, api := range result.Report.APIs {
+		if api.Support != SupportPolyfilled {
+			continue
+		}
+		for _, file := range api.Files {
+			if background[file] {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("%s is used by the background script %s, which the shim can't reach; move it into a content script", api.API, file))
+			} else if result.ShimmedScripts == 0 {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("%s is used by %s, but there are no content scripts to add the shim to", api.API, file))
+			}
+		}
+	}
+	return result, nil
+}
+
+// stripDefaultPopup removes default_popup from the manifest's key object,
+// reporting whether there was one.
+func stripDefaultPopup(manifest map[string]json.RawMessage, key string) bool {
+	var action map[string]json.RawMessage
+	if json.Unmarshal(manifest[key], &action) != nil {
+		return false
+	}
+	if _, ok := action["default_popup"]; !ok {
+		return false
+	}
+	delete(action, "default_popup")
+	manifest[key], _ = json.Marshal(action)
+	return true
+}
+
+// backgroundScripts returns the background page's scripts or service worker,
+// relative to the extension folder.
+func backgroundScripts(manifest map[string]json.RawMessage) map[string]bool {
+	var background struct {
+		ServiceWorker string   `json:"service_worker"`
+		Scripts       []string `json:"scripts"`
+	}
+	json.Unmarshal(manifest["background"], &background)
+	files := map[string]bool{}
+	for _, f := range append(background.Scripts, background.ServiceWorker) {
+		if f != "" {
+			files[strings.TrimPrefix(f, "/")] = true
+		}
+	}
+	return files
+}
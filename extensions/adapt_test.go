@@ -0,0 +1,131 @@
+package extensions
+
+import (
+	"bytes"
+	"claude-webext-patcher/protocol"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAdapt(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	os.MkdirAll(src, 0755)
+	manifest := `{
+		"manifest_version": 3, "name": "Test", "version": "1.0",
+		"permissions": ["storage", "alarms", "contextMenus", "https://claude.ai/*"],
+		"action": {"default_popup": "popup.html", "default_title": "Test"},
+		"options_page": "options.html",
+		"background": {"service_worker": "bg.js"},
+		"content_scripts": [
+			{"matches": ["https://claude.ai/*"], "js": ["content.js"]},
+			{"matches": ["https://claude.ai/*"], "css": ["style.css"]}
+		]
+	}`
+	os.WriteFile(filepath.Join(src, "manifest.json"), []byte(manifest), 0644)
+	os.WriteFile(filepath.Join(src, "content.js"), []byte(`chrome.alarms.create("a", {periodInMinutes: 1});`), 0644)
+	os.WriteFile(filepath.Join(src, "bg.js"), []byte(`chrome.alarms.onAlarm.addListener(() => {});`), 0644)
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	result, err := Adapt(context.Background(), src, dst)
+	if err != nil {
+		t.Fatalf("Adapt: %v", err)
+	}
+
+	wantRemoved := []string{`action.default_popup`, `options_page`, `permissions "alarms"`, `permissions "contextMenus"`}
+	if !reflect.DeepEqual(result.Removed, wantRemoved) {
+		t.Errorf("Removed = %q, want %q", result.Removed, wantRemoved)
+	}
+	if result.ShimmedScripts != 1 {
+		t.Errorf("ShimmedScripts = %d, want 1", result.ShimmedScripts)
+	}
+	if len(result.Warnings) != 1 {
+		t.Errorf("Warnings = %q, want one about bg.js", result.Warnings)
+	}
+	for _, api := range result.Report.APIs {
+		for _, file := range api.Files {
+			if file == ShimFile {
+				t.Errorf("lint report includes the shim: %+v", api)
+			}
+		}
+	}
+
+	var got struct {
+		Permissions    []string `json:"permissions"`
+		Action         map[string]string
+		ContentScripts []struct {
+			JS []string `json:"js"`
+		} `json:"content_scripts"`
+	}
+	data, _ := os.ReadFile(filepath.Join(dst, "manifest.json"))
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("parsing adapted manifest: %v", err)
+	}
+	if want := []string{"storage", "https://claude.ai/*"}; !reflect.DeepEqual(got.Permissions, want) {
+		t.Errorf("permissions = %q, want %q", got.Permissions, want)
+	}
+	if want := map[string]string{"default_title": "Test"}; !reflect.DeepEqual(got.Action, want) {
+		t.Errorf("action = %v, want %v", got.Action, want)
+	}
+	if want := []string{ShimFile, "content.js"}; !reflect.DeepEqual(got.ContentScripts[0].JS, want) {
+		t.Errorf("content_scripts[0].js = %q, want %q", got.ContentScripts[0].JS, want)
+	}
+	if got.ContentScripts[1].JS != nil {
+		t.Errorf("content_scripts[1].js = %q, want none", got.ContentScripts[1].JS)
+	}
+
+	shim, err := os.ReadFile(filepath.Join(dst, ShimFile))
+	if err != nil {
+		t.Fatalf("reading shim: %v", err)
+	}
+	for _, s := range []string{protocol.AlarmPrefix, protocol.NotificationPrefix, protocol.AlarmFiredEvent, protocol.TabActivatedEvent, protocol.TabRemovedEvent} {
+		if !bytes.Contains(shim, []byte(`"`+s+`"`)) {
+			t.Errorf("shim does not use %q", s)
+		}
+	}
+
+	if _, err := Adapt(context.Background(), src, dst); err == nil {
+		t.Errorf("Adapt into an existing folder succeeded")
+	}
+}
+
+func TestLintPolyfillsNeedShim(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "content.js"), []byte(`chrome.alarms.create("a", {}); chrome.storage.local.get();`), 0644)
+	support := func(manifest string) (map[string]APIUse, []string) {
+		os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0644)
+		report, err := Lint(dir)
+		if err != nil {
+			t.Fatalf("Lint: %v", err)
+		}
+		apis := map[string]APIUse{}
+		for _, api := range report.APIs {
+			apis[api.API] = api
+		}
+		return apis, report.ManifestIssues
+	}
+
+	apis, issues := support(`{"manifest_version": 3, "permissions": ["alarms"],
+		"content_scripts": [{"matches": ["https://claude.ai/*"], "js": ["content.js"]}]}`)
+	if got := apis["chrome.alarms.create"]; got.Support != SupportUnsupported || got.Hint != adaptHint {
+		t.Errorf("without the shim: chrome.alarms.create = %+v", got)
+	}
+	if got := apis["chrome.storage.local"]; got.Support != SupportNative {
+		t.Errorf("without the shim: chrome.storage.local = %+v", got)
+	}
+	if len(issues) != 1 {
+		t.Errorf("without the shim: manifest issues = %q, want the alarms permission", issues)
+	}
+
+	apis, issues = support(`{"manifest_version": 3,
+		"content_scripts": [{"matches": ["https://claude.ai/*"], "js": ["` + ShimFile + `", "content.js"]}]}`)
+	if got := apis["chrome.alarms.create"]; got.Support != SupportPolyfilled || got.Hint != "" {
+		t.Errorf("with the shim: chrome.alarms.create = %+v", got)
+	}
+	if len(issues) != 0 {
+		t.Errorf("with the shim: manifest issues = %q", issues)
+	}
+}
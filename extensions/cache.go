@@ -0,0 +1,131 @@
+package extensions
+
+import (
+	"claude-webext-patcher/utils"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Release metadata fetched from sources is cached next to the launcher, so repeated
+// update checks within releaseCacheTTL don't call the forge APIs again. Local
+// sources are read directly. The cache is user-writable, so elevated processes
+// fetch fresh metadata instead of trusting its download and signature URLs.
+const releaseCacheTTL = 10 * time.Minute
+
+// maxConcurrent caps how many extensions are checked or updated at once.
+const maxConcurrent = 4
+
+// cachedReleases is one source's entry in the release cache. Latest entries hold a
+// single release; list entries every release, newest first.
+type cachedReleases struct {
+	FetchedAt time.Time  `json:"fetched_at"`
+	Releases  []*Release `json:"releases"`
+}
+
+// releaseCacheMu serializes the cache's read-modify-write within this process.
+var releaseCacheMu sync.Mutex
+
+func releaseCachePath() string {
+	return utils.ResolvePath("release-cache.json")
+}
+
+func loadReleaseCache() map[string]cachedReleases {
+	cache := map[string]cachedReleases{}
+	if data, err := os.ReadFile(releaseCachePath()); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	return cache
+}
+
+// releaseCacheKey identifies what was fetched from src: its latest release or its
+// release list, in the channel Beta selects.
+func releaseCacheKey(src Source, list bool) string {
+	key := "latest:" + src.String()
+	if list {
+		key = "list:" + src.String()
+	}
+	if Beta {
+		key += "#beta"
+	}
+	return key
+}
+
+// cachedFetch returns the releases cached under key if they are fresh and the
+// process isn't elevated, and otherwise calls fetch and caches its result.
+func cachedFetch(key string, fetch func() ([]*Release, error)) ([]*Release, error) {
+	if !utils.IsElevated() {
+		releaseCacheMu.Lock()
+		entry, ok := loadReleaseCache()[key]
+		releaseCacheMu.Unlock()
+		if ok && time.Since(entry.FetchedAt) < releaseCacheTTL {
+			return entry.Releases, nil
+		}
+	}
+
+	releases, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	releaseCacheMu.Lock()
+	defer releaseCacheMu.Unlock()
+	cache := loadReleaseCache()
+	for k, e := range cache {
+		if time.Since(e.FetchedAt) >= releaseCacheTTL {
+			delete(cache, k)
+		}
+	}
+	cache[key] = cachedReleases{FetchedAt: time.Now().UTC(), Releases: releases}
+	if data, err := json.MarshalIndent(cache, "", "  "); err == nil {
+		tmp := releaseCachePath() + ".tmp"
+		if os.WriteFile(tmp, data, 0644) == nil {
+			os.Rename(tmp, releaseCachePath())
+		}
+	}
+	return releases, nil
+}
+
+// cachedLatest is src.Latest through the release cache.
+func cachedLatest(ctx context.Context, src Source) (*Release, error) {
+	if _, ok := src.(*localSource); ok {
+		return src.Latest(ctx)
+	}
+	releases, err := cachedFetch(releaseCacheKey(src, false), func() ([]*Release, error) {
+		release, err := src.Latest(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []*Release{release}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return releases[0], nil
+}
+
+// cachedList is lister.Releases through the release cache.
+func cachedList(ctx context.Context, src Source, lister releaseLister) ([]*Release, error) {
+	return cachedFetch(releaseCacheKey(src, true), func() ([]*Release, error) {
+		return lister.Releases(ctx)
+	})
+}
+
+// forEachConcurrently calls fn for every extension in exts, at most maxConcurrent at
+// a time, and waits for all of them to return.
+func forEachConcurrently(exts []Extension, fn func(Extension)) {
+	sem := make(chan struct{}, maxConcurrent)
+	var wg sync.WaitGroup
+	for _, ext := range exts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(ext Extension) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(ext)
+		}(ext)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,34 @@
+package extensions
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachConcurrently(t *testing.T) {
+	var exts []Extension
+	for i := 0; i < 3*maxConcurrent; i++ {
+		exts = append(exts, Extension{Folder: "ext" + strconv.Itoa(i)})
+	}
+	var running, peak, done atomic.Int32
+	forEachConcurrently(exts, func(Extension) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		done.Add(1)
+	})
+	if int(done.Load()) != len(exts) {
+		t.Errorf("ran %d of %d", done.Load(), len(exts))
+	}
+	if peak.Load() > maxConcurrent {
+		t.Errorf("%d ran at once, want at most %d", peak.Load(), maxConcurrent)
+	}
+}
@@ -0,0 +1,212 @@
+package extensions
+
+import (
+	"claude-webext-patcher/semver"
+	"claude-webext-patcher/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Extensions declare the Claude versions they work with in a claude_webext section,
+// either in their manifest.json:
+//
+//	"claude_webext": { "claude": ">=0.12.0 <0.14.0" }
+//
+// or in their registry entry, as rules optionally limited to some releases:
+//
+//	"claude_webext": [{ "versions": "<2.0.0", "claude": "<0.14.0" }]
+//
+// Ranges use semver.Satisfies syntax. Extensions that declare nothing support every
+// version.
+type CompatRule struct {
+	// Versions is the range of extension versions the rule covers; empty means all.
+	Versions string `json:"versions,omitempty"`
+	// Claude is the range of Claude versions they support.
+	Claude string `json:"claude"`
+}
+
+// maxCompatDownloads caps how many releases one update downloads while looking for
+// one whose manifest supports the installed Claude. Rejected releases are
+// remembered, so the next update carries on with older ones.
+const maxCompatDownloads = 3
+
+// ClaudeVersion returns the installed Claude version, or "" if it isn't known.
+func ClaudeVersion() string {
+	data, err := os.ReadFile(utils.ResolveInstallPath("claude-version.txt"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// incompatibleError is returned when a release doesn't support the installed Claude.
+type incompatibleError struct {
+	Version string
+	Range   string
+	Claude  string
+}
+
+func (e *incompatibleError) Error() string {
+	return fmt.Sprintf("%s supports Claude %s, but Claude %s is installed", e.Version, e.Range, e.Claude)
+}
+
+// supportsClaude reports whether claude is in rng. Undeclared ranges and an unknown
+// Claude version are always fine; invalid ranges never are.
+func supportsClaude(rng, claude string) bool {
+	if rng == "" || claude == "" {
+		return true
+	}
+	ok, err := semver.Satisfies(claude, rng)
+	return err == nil && ok
+}
+
+// registryRange returns the Claude range ext's registry rules give version, or "".
+func (e Extension) registryRange(version string) string {
+	for _, rule := range e.ClaudeWebext {
+		if rule.Versions == "" {
+			return rule.Claude
+		}
+		if ok, err := semver.Satisfies(version, rule.Versions); err == nil && ok {
+			return rule.Claude
+		}
+	}
+	return ""
+}
+
+// manifestRange returns the Claude range declared in dir's manifest.json, or "".
+func manifestRange(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return ""
+	}
+	var manifest struct {
+		ClaudeWebext struct {
+			Claude string `json:"claude"`
+		} `json:"claude_webext"`
+	}
+	if json.Unmarshal(data, &manifest) != nil {
+		return ""
+	}
+	return manifest.ClaudeWebext.Claude
+}
+
+// releaseRange returns the Claude range that applies to release version of ext,
+// unpacked in dir: its registry rules take precedence over its manifest.
+func releaseRange(ext Extension, version, staged string) string {
+	if rng := ext.registryRange(version); rng != "" {
+		return rng
+	}
+	return manifestRange(staged)
+}
+
+// compatCachePath holds the ranges of releases that were downloaded and turned out
+// not to support the installed Claude, keyed by folder and version, so later
+// updates can skip them without downloading them again.
+func compatCachePath() string {
+	return utils.ResolveInstallPath("extensions-compat.json")
+}
+
+func loadCompatCache() map[string]map[string]string {
+	cache := map[string]map[string]string{}
+	if data, err := os.ReadFile(compatCachePath()); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	return cache
+}
+
+// compatCacheMu serializes rememberRange across concurrent updates.
+var compatCacheMu sync.Mutex
+
+// rememberRange records the Claude range of a release of folder.
+func rememberRange(folder, version, rng string) {
+	compatCacheMu.Lock()
+	defer compatCacheMu.Unlock()
+	cache := loadCompatCache()
+	if cache[folder] == nil {
+		cache[folder] = map[string]string{}
+	}
+	cache[folder][version] = rng
+	if data, err := json.MarshalIndent(cache, "", "  "); err == nil {
+		os.WriteFile(compatCachePath(), data, 0644)
+	}
+}
+
+// knownRange returns the Claude range of release version of ext as far as it is
+// known without downloading it.
+func knownRange(ext Extension, version string, cache map[string]map[string]string) string {
+	if rng := ext.registryRange(version); rng != "" {
+		return rng
+	}
+	return cache[ext.Folder][version]
+}
+
+// olderReleases returns the releases of ext older than newest and newer than
+// current, newest first, if its source can list them.
+func olderReleases(ctx context.Context, ext Extension, newest *Release, current string) []*Release {
+	src, err := ext.source()
+	if err != nil {
+		return nil
+	}
+	lister, ok := src.(releaseLister)
+	if !ok {
+		return nil
+	}
+	releases, err := cachedList(ctx, src, lister)
+	if err != nil {
+		fmt.Printf("  %s: could not list older releases: %v\n", ext.Folder, err)
+		return nil
+	}
+	var older []*Release
+	for _, r := range releases {
+		if semver.Compare(r.Version, newest.Version) < 0 && semver.Compare(r.Version, current) > 0 && r.Version != ext.SkipVersion {
+			older = append(older, r)
+		}
+	}
+	return older
+}
+
+// installedIncompatibility returns why the installed version of ext doesn't support
+// claude, or nil.
+func installedIncompatibility(ext Extension, claude string) *incompatibleError {
+	dir := filepath.Join(extensionsDir(), ext.Folder)
+	version := getInstalledVersion(ext)
+	if version == "" || claude == "" {
+		return nil
+	}
+	rng := releaseRange(ext, version, dir)
+	if supportsClaude(rng, claude) {
+		return nil
+	}
+	return &incompatibleError{Version: ext.Folder + " " + version, Range: rng, Claude: claude}
+}
+
+// WarnIncompatible prints a warning for every installed extension whose version
+// doesn't support the installed Claude.
+func WarnIncompatible() {
+	claude := ClaudeVersion()
+	if claude == "" {
+		return
+	}
+	byFolder := map[string]Extension{}
+	for _, ext := range registry() {
+		byFolder[ext.Folder] = ext
+	}
+	entries, _ := os.ReadDir(extensionsDir())
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == SentinelFolder {
+			continue
+		}
+		ext, ok := byFolder[entry.Name()]
+		if !ok {
+			ext = Extension{Folder: entry.Name()}
+		}
+		if err := installedIncompatibility(ext, claude); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+}
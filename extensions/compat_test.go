@@ -0,0 +1,67 @@
+package extensions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReleaseRange(t *testing.T) {
+	dir := t.TempDir()
+	manifest := `{"version": "2.1.0", "claude_webext": {"claude": ">=0.14.0"}}`
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ext := Extension{Folder: "x", ClaudeWebext: []CompatRule{{Versions: "<2.0.0", Claude: "<0.14.0"}}}
+
+	if got := releaseRange(ext, "1.9.3", dir); got != "<0.14.0" {
+		t.Errorf("registry rule: got %q", got)
+	}
+	if got := releaseRange(ext, "2.1.0", dir); got != ">=0.14.0" {
+		t.Errorf("manifest: got %q", got)
+	}
+	if got := releaseRange(Extension{}, "2.1.0", t.TempDir()); got != "" {
+		t.Errorf("undeclared: got %q", got)
+	}
+
+	for _, tc := range []struct {
+		rng, claude string
+		want        bool
+	}{
+		{"", "0.13.0", true},
+		{">=0.14.0", "", true},
+		{">=0.14.0", "0.13.9", false},
+		{">=0.14.0", "0.14.2", true},
+		{"~0.14", "0.14.2", false},
+	} {
+		if got := supportsClaude(tc.rng, tc.claude); got != tc.want {
+			t.Errorf("supportsClaude(%q, %q) = %v, want %v", tc.rng, tc.claude, got, tc.want)
+		}
+	}
+}
+
+func TestMergeRegistryClaudeWebext(t *testing.T) {
+	builtin := []CompatRule{{Claude: ">=0.13.0"}}
+	override := []CompatRule{{Versions: "<2.0.0", Claude: "<0.14.0"}}
+	defaults := []Extension{
+		{Folder: "a", Source: "github:o/a", ClaudeWebext: builtin},
+		{Folder: "b", Source: "github:o/b", ClaudeWebext: builtin},
+		{Folder: "c", Source: "github:o/c", ClaudeWebext: builtin},
+	}
+	user := []Extension{
+		{Folder: "a", ClaudeWebext: override},
+		{Folder: "b", SkipVersion: "1.0.0"},
+		{Folder: "c", ClaudeWebext: []CompatRule{}},
+	}
+	merged := mergeRegistry(defaults, user)
+
+	if got := merged[0].ClaudeWebext; len(got) != 1 || got[0] != override[0] {
+		t.Errorf("override: got %+v", got)
+	}
+	if got := merged[1].ClaudeWebext; len(got) != 1 || got[0] != builtin[0] {
+		t.Errorf("unset in the user entry: got %+v", got)
+	}
+	if got := merged[2].ClaudeWebext; len(got) != 0 {
+		t.Errorf("cleared: got %+v", got)
+	}
+}
@@ -0,0 +1,280 @@
+package extensions
+
+import (
+	"bytes"
+	"claude-webext-patcher/utils"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CRX3 layout: "Cr24", a little-endian uint32 format version (3), a little-endian
+// uint32 header length, a CrxFileHeader protobuf, and the zip archive.
+//
+//	message CrxFileHeader {
+//	  repeated AsymmetricKeyProof sha256_with_rsa = 2;
+//	  repeated AsymmetricKeyProof sha256_with_ecdsa = 3;
+//	  optional bytes signed_header_data = 10000; // a serialized SignedData
+//	}
+//	message AsymmetricKeyProof { optional bytes public_key = 1; optional bytes signature = 2; }
+//	message SignedData { optional bytes crx_id = 1; }
+//
+// Every proof signs "CRX3 SignedData\x00" + uint32le(len(signed_header_data)) +
+// signed_header_data + archive with SHA-256.
+const (
+	crxMagic          = "Cr24"
+	crxSignatureLabel = "CRX3 SignedData\x00"
+	// crxMaxHeaderSize guards against absurd header lengths in corrupt files.
+	crxMaxHeaderSize = 1 << 20
+)
+
+// CRX is a parsed and verified CRX3 package.
+type CRX struct {
+	// ID is the Chrome extension ID (32 characters a-p) derived from the
+	// developer key.
+	ID string
+	// PublicKey is the DER-encoded SubjectPublicKeyInfo of the developer key.
+	PublicKey []byte
+	// Archive is the embedded zip.
+	Archive []byte
+}
+
+type crxKeyProof struct {
+	publicKey []byte
+	signature []byte
+}
+
+// ParseCRX parses a CRX3 package and verifies every signature in its header. The
+// package's crx_id must belong to one of the signing keys (the developer key), so
+// a valid CRX can't be re-signed under another extension's ID.
+func ParseCRX(data []byte) (*CRX, error) {
+	if len(data) < 12 || string(data[:4]) != crxMagic {
+		return nil, errors.New("not a CRX file")
+	}
+	if v := binary.LittleEndian.Uint32(data[4:8]); v != 3 {
+		return nil, fmt.Errorf("unsupported CRX version %d (only CRX3 is supported)", v)
+	}
+	headerSize := binary.LittleEndian.Uint32(data[8:12])
+	if headerSize > crxMaxHeaderSize || int(headerSize) > len(data)-12 {
+		return nil, fmt.Errorf("invalid CRX header size %d", headerSize)
+	}
+	header := data[12 : 12+headerSize]
+	archive := data[12+headerSize:]
+
+	var rsaProofs, ecdsaProofs []crxKeyProof
+	var signedHeader []byte
+	err := walkProto(header, func(field int, value []byte) error {
+		switch field {
+		case 2, 3:
+			var proof crxKeyProof
+			err := walkProto(value, func(field int, value []byte) error {
+				switch field {
+				case 1:
+					proof.publicKey = value
+				case 2:
+					proof.signature = value
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if field == 2 {
+				rsaProofs = append(rsaProofs, proof)
+			} else {
+				ecdsaProofs = append(ecdsaProofs, proof)
+			}
+		case 10000:
+			signedHeader = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("parsing CRX header: %v", err)
+	}
+
+	var crxID []byte
+	if err := walkProto(signedHeader, func(field int, value []byte) error {
+		if field == 1 {
+			crxID = value
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("parsing CRX signed data: %v", err)
+	}
+	if len(crxID) != 16 {
+		return nil, errors.New("CRX header has no valid crx_id")
+	}
+	if len(rsaProofs)+len(ecdsaProofs) == 0 {
+		return nil, errors.New("CRX is not signed")
+	}
+
+	// The signed message is the same for every proof.
+	h := sha256.New()
+	h.Write([]byte(crxSignatureLabel))
+	binary.Write(h, binary.LittleEndian, uint32(len(signedHeader)))
+	h.Write(signedHeader)
+	h.Write(archive)
+	digest := h.Sum(nil)
+
+	crx := &CRX{Archive: archive}
+	check := func(proof crxKeyProof, verify func(pub interface{}) bool) error {
+		pub, err := x509.ParsePKIXPublicKey(proof.publicKey)
+		if err != nil {
+			return fmt.Errorf("parsing CRX public key: %v", err)
+		}
+		if !verify(pub) {
+			return errors.New("CRX signature verification failed")
+		}
+		keyHash := sha256.Sum256(proof.publicKey)
+		if bytes.Equal(keyHash[:16], crxID) {
+			crx.PublicKey = proof.publicKey
+		}
+		return nil
+	}
+	for _, proof := range rsaProofs {
+		err := check(proof, func(pub interface{}) bool {
+			key, ok := pub.(*rsa.PublicKey)
+			return ok && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, proof.signature) == nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, proof := range ecdsaProofs {
+		err := check(proof, func(pub interface{}) bool {
+			key, ok := pub.(*ecdsa.PublicKey)
+			return ok && ecdsa.VerifyASN1(key, digest, proof.signature)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if crx.PublicKey == nil {
+		return nil, errors.New("CRX crx_id does not match any signing key")
+	}
+	crx.ID = crxIDString(crxID)
+	return crx, nil
+}
+
+// crxIDString encodes the first 16 bytes of a key hash the way Chrome does: each hex
+// digit 0-f becomes a letter a-p.
+func crxIDString(id []byte) string {
+	out := []byte(hex.EncodeToString(id))
+	for i, c := range out {
+		if c <= '9' {
+			out[i] = 'a' + (c - '0')
+		} else {
+			out[i] = 'a' + 10 + (c - 'a')
+		}
+	}
+	return string(out)
+}
+
+// walkProto calls fn for each length-delimited field of a protobuf message. Other
+// wire types are skipped.
+func walkProto(msg []byte, fn func(field int, value []byte) error) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errors.New("malformed field key")
+		}
+		msg = msg[n:]
+		field, wireType := int(key>>3), key&7
+		switch wireType {
+		case 0: // varint
+			_, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return errors.New("malformed varint")
+			}
+			msg = msg[n:]
+		case 1: // fixed64
+			if len(msg) < 8 {
+				return errors.New("truncated fixed64")
+			}
+			msg = msg[8:]
+		case 5: // fixed32
+			if len(msg) < 4 {
+				return errors.New("truncated fixed32")
+			}
+			msg = msg[4:]
+		case 2: // length-delimited
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || size > uint64(len(msg)-n) {
+				return errors.New("truncated length-delimited field")
+			}
+			value := msg[n : n+int(size)]
+			msg = msg[n+int(size):]
+			if err := fn(field, value); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported wire type %d", wireType)
+		}
+	}
+	return nil
+}
+
+// installCRX verifies the CRX at path and extracts it into dest.
+// If expectedID is set the package must carry that extension ID. The developer key
+// is written into manifest.json as "key" so Electron assigns the extension the same
+// ID Chrome does. It returns the extension ID.
+func installCRX(ctx context.Context, path, dest, expectedID string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	crx, err := ParseCRX(data)
+	if err != nil {
+		return "", err
+	}
+	if expectedID != "" && crx.ID != expectedID {
+		return "", fmt.Errorf("CRX extension ID %s does not match the recorded ID %s", crx.ID, expectedID)
+	}
+
+	archivePath := utils.ResolvePath(filepath.Base(dest) + "-crx.zip")
+	defer os.Remove(archivePath)
+	if err := os.WriteFile(archivePath, crx.Archive, 0644); err != nil {
+		return "", err
+	}
+	if err := extractExtensionZip(ctx, archivePath, dest); err != nil {
+		return "", err
+	}
+	if err := setManifestKey(filepath.Join(dest, "manifest.json"), crx.PublicKey); err != nil {
+		return "", err
+	}
+	return crx.ID, nil
+}
+
+// setManifestKey adds the base64 public key to a manifest that doesn't declare one.
+func setManifestKey(manifestPath string, publicKey []byte) error {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("reading manifest.json: %v", err)
+	}
+	var manifest map[string]json.RawMessage
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("parsing manifest.json: %v", err)
+	}
+	if _, ok := manifest["key"]; ok {
+		return nil
+	}
+	key, _ := json.Marshal(base64.StdEncoding.EncodeToString(publicKey))
+	manifest["key"] = key
+	data, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manifestPath, data, 0644)
+}
@@ -0,0 +1,113 @@
+package extensions
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// protoField encodes a length-delimited protobuf field.
+func protoField(field int, value []byte) []byte {
+	out := binary.AppendUvarint(nil, uint64(field)<<3|2)
+	out = binary.AppendUvarint(out, uint64(len(value)))
+	return append(out, value...)
+}
+
+// buildCRX signs archive with rsaKey (the developer key, which determines the ID)
+// and, if set, an additional ECDSA key.
+func buildCRX(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey, archive []byte) []byte {
+	t.Helper()
+	rsaPub, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyHash := sha256.Sum256(rsaPub)
+	signedHeader := protoField(1, keyHash[:16])
+
+	h := sha256.New()
+	h.Write([]byte(crxSignatureLabel))
+	binary.Write(h, binary.LittleEndian, uint32(len(signedHeader)))
+	h.Write(signedHeader)
+	h.Write(archive)
+	digest := h.Sum(nil)
+
+	rsaSig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := protoField(2, append(protoField(1, rsaPub), protoField(2, rsaSig)...))
+	if ecKey != nil {
+		ecPub, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ecSig, err := ecdsa.SignASN1(rand.Reader, ecKey, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header = append(header, protoField(3, append(protoField(1, ecPub), protoField(2, ecSig)...))...)
+	}
+	header = append(header, protoField(10000, signedHeader)...)
+
+	out := []byte(crxMagic)
+	out = binary.LittleEndian.AppendUint32(out, 3)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(header)))
+	out = append(out, header...)
+	return append(out, archive...)
+}
+
+func TestParseCRX(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := []byte("PK\x03\x04 not really a zip, but the parser doesn't care")
+	data := buildCRX(t, rsaKey, ecKey, archive)
+
+	crx, err := ParseCRX(data)
+	if err != nil {
+		t.Fatalf("ParseCRX: %v", err)
+	}
+	if string(crx.Archive) != string(archive) {
+		t.Errorf("archive mismatch")
+	}
+	if len(crx.ID) != 32 || strings.Trim(crx.ID, "abcdefghijklmnop") != "" {
+		t.Errorf("ID %q is not 32 characters a-p", crx.ID)
+	}
+	pub, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if string(crx.PublicKey) != string(pub) {
+		t.Errorf("PublicKey is not the developer key")
+	}
+
+	// Tampering with the archive must break every signature.
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-1] ^= 0xff
+	if _, err := ParseCRX(tampered); err == nil {
+		t.Errorf("ParseCRX accepted a tampered archive")
+	}
+
+	if _, err := ParseCRX(archive); err == nil {
+		t.Errorf("ParseCRX accepted a file without the CRX magic")
+	}
+}
+
+// TestCRXIDString checks the hex to a-p mapping against a known Chrome ID: the
+// Chrome Web Store app, whose key hash starts with 0756484d..., has the ID
+// ahfgeienlihckogmohjhadlkjgocpleb.
+func TestCRXIDString(t *testing.T) {
+	id := []byte{0x07, 0x56, 0x48, 0x4d, 0xb8, 0x72, 0xae, 0x6c, 0xe7, 0x97, 0x03, 0xba, 0x96, 0xe2, 0xfb, 0x41}
+	if got, want := crxIDString(id), "ahfgeienlihckogmohjhadlkjgocpleb"; got != want {
+		t.Errorf("crxIDString = %s, want %s", got, want)
+	}
+}
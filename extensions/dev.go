@@ -0,0 +1,230 @@
+package extensions
+
+import (
+	"claude-webext-patcher/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// "ext dev" links an extension under development into web-extensions and keeps
+// running instances up to date with it. Linked folders are listed in the dev
+// control file, which the wrapper watches: whenever an entry's Reload counter
+// changes, it reloads that extension and the claude.ai page. While any folder is
+// linked, caches aren't cleared on startup.
+type DevLink struct {
+	// Path is the folder under development.
+	Path string `json:"path"`
+	// Copied is set when web-extensions holds a synced copy of Path rather than a
+	// symlink to it, because symlinks aren't available.
+	Copied bool `json:"copied,omitempty"`
+	// Reload is bumped every time Path changes.
+	Reload int `json:"reload"`
+}
+
+type devFile struct {
+	Extensions map[string]*DevLink `json:"extensions"`
+}
+
+// DevControlPath returns the location of the dev control file. It lives next to
+// the launcher, where the wrapper can read it without elevation.
+func DevControlPath() string {
+	return utils.ResolvePath("dev-extensions.json")
+}
+
+func loadDevLinks() map[string]*DevLink {
+	f := devFile{}
+	if data, err := os.ReadFile(DevControlPath()); err == nil {
+		json.Unmarshal(data, &f)
+	}
+	if f.Extensions == nil {
+		f.Extensions = map[string]*DevLink{}
+	}
+	return f.Extensions
+}
+
+// saveDevLinks replaces the control file in one rename, so the wrapper never reads
+// it half-written. It is removed once nothing is linked.
+func saveDevLinks(links map[string]*DevLink) error {
+	if len(links) == 0 {
+		if err := os.Remove(DevControlPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(devFile{Extensions: links}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := DevControlPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, DevControlPath())
+}
+
+// DevActive reports whether any extension is linked with "ext dev".
+func DevActive() bool {
+	return len(loadDevLinks()) > 0
+}
+
+// unlinkDev removes folder's dev link, if it has one, from web-extensions and the
+// control file.
+func unlinkDev(folder string) error {
+	links := loadDevLinks()
+	link, ok := links[folder]
+	if !ok {
+		return nil
+	}
+	dst := filepath.Join(extensionsDir(), folder)
+	if link.Copied {
+		os.RemoveAll(dst)
+	} else {
+		os.Remove(dst)
+	}
+	delete(links, folder)
+	return saveDevLinks(links)
+}
+
+// devInterval is how often Dev looks for changes.
+const devInterval = 500 * time.Millisecond
+
+// Dev links the unpacked extension at src into web-extensions/<folder> (by default
+// named after src) and, until ctx is done, signals running instances to reload it
+// whenever its files change. The link is removed when Dev returns.
+func Dev(ctx context.Context, src, folder string) error {
+	src, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	if err := validateStaged(src, ""); err != nil {
+		return fmt.Errorf("%s: %v", src, err)
+	}
+	if folder == "" {
+		folder = defaultFolder(src)
+	}
+	if err := checkFolderName(folder); err != nil {
+		return err
+	}
+	for _, ext := range registry() {
+		if ext.Folder == folder && ext.Source != "" {
+			return fmt.Errorf("%s is a managed extension; choose another folder with --folder", folder)
+		}
+	}
+
+	dst := filepath.Join(extensionsDir(), folder)
+	links := loadDevLinks()
+	if link, ok := links[folder]; ok {
+		// Left behind by a dev session that didn't exit cleanly.
+		if link.Path != src {
+			return fmt.Errorf("%s is already linked to %s", folder, link.Path)
+		}
+		if err := unlinkDev(folder); err != nil {
+			return err
+		}
+		links = loadDevLinks()
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+
+	if err := os.MkdirAll(extensionsDir(), 0755); err != nil {
+		return err
+	}
+	link := &DevLink{Path: src}
+	if err := os.Symlink(src, dst); err != nil {
+		fmt.Printf("Can't create a symlink (%v), syncing a copy instead\n", err)
+		link.Copied = true
+		if err := copyExtensionDir(ctx, src, dst); err != nil {
+			os.RemoveAll(dst)
+			return err
+		}
+	}
+	links[folder] = link
+	if err := saveDevLinks(links); err != nil {
+		return err
+	}
+	defer func() {
+		if err := unlinkDev(folder); err != nil {
+			fmt.Printf("Warning: could not unlink %s: %v\n", folder, err)
+		}
+	}()
+
+	fmt.Printf("Linked %s -> %s\n", dst, src)
+	fmt.Println("Watching for changes; running instances reload the extension after each one. Press Ctrl-C to stop.")
+
+	last := treeFingerprint(src)
+	pending := false
+	ticker := time.NewTicker(devInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Printf("Unlinking %s\n", folder)
+			return nil
+		case <-ticker.C:
+		}
+
+		// Wait for a tick without changes, so a build that writes many files is
+		// picked up once it's done.
+		current := treeFingerprint(src)
+		if current != last {
+			last, pending = current, true
+			continue
+		}
+		if !pending {
+			continue
+		}
+		pending = false
+
+		if err := validateStaged(src, ""); err != nil {
+			fmt.Printf("  %s: %v; waiting for the next change\n", folder, err)
+			continue
+		}
+		if link.Copied {
+			os.RemoveAll(dst)
+			if err := copyExtensionDir(ctx, src, dst); err != nil {
+				fmt.Printf("  %s: syncing failed: %v\n", folder, err)
+				continue
+			}
+		}
+		links := loadDevLinks()
+		if links[folder] == nil {
+			return fmt.Errorf("%s was unlinked", folder)
+		}
+		link.Reload = links[folder].Reload + 1
+		links[folder] = link
+		if err := saveDevLinks(links); err != nil {
+			fmt.Printf("  %s: could not signal the reload: %v\n", folder, err)
+			continue
+		}
+		fmt.Printf("  %s: changed at %s, reloading\n", folder, time.Now().Format("15:04:05"))
+	}
+}
+
+// treeFingerprint hashes the names, sizes and modification times of the files
+// under dir, skipping hidden folders such as .git.
+func treeFingerprint(dir string) uint64 {
+	h := fnv.New64a()
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return h.Sum64()
+}
@@ -1,40 +1,33 @@
 package extensions
 
 import (
-	"archive/zip"
+	"claude-webext-patcher/semver"
 	"claude-webext-patcher/utils"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
+	"sync/atomic"
 )
 
-type Extension struct {
-	Owner  string // GitHub owner
-	Repo   string // GitHub repo name
-	Folder string // Local folder name in extensions/
-}
-
-var extensions = []Extension{
-	{Owner: "lugia19", Repo: "Claude-Usage-Extension", Folder: "usage-tracker"},
-	{Owner: "lugia19", Repo: "Claude-Toolbox", Folder: "userscript-toolbox"},
-}
-
-type extensionRelease struct {
-	TagName string `json:"tag_name"`
-	Assets  []struct {
-		Name        string `json:"name"`
-		DownloadURL string `json:"browser_download_url"`
-	} `json:"assets"`
+// getInstalledVersion returns the installed version of ext. The manifest can't
+// say which prerelease it came from, so the version recorded in the marker is
+// preferred when it matches.
+func getInstalledVersion(ext Extension) string {
+	dir := filepath.Join(utils.ResolveInstallPath("web-extensions"), ext.Folder)
+	version := manifestVersion(dir)
+	if m := readMarker(dir); m != nil && version != "" && semver.Compare(semver.Core(m.Version), version) == 0 {
+		return m.Version
+	}
+	return version
 }
 
-func getInstalledVersion(ext Extension) string {
-	manifestPath := filepath.Join(utils.ResolveInstallPath("web-extensions"), ext.Folder, "manifest.json")
-	data, err := os.ReadFile(manifestPath)
+// manifestVersion returns the version in dir's manifest.json, or "".
+func manifestVersion(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
 	if err != nil {
 		return ""
 	}
@@ -47,162 +40,316 @@ func getInstalledVersion(ext Extension) string {
 	return ""
 }
 
-func fetchLatestRelease(ext Extension) (*extensionRelease, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", ext.Owner, ext.Repo)
-	resp, err := http.Get(url)
+// latestRelease resolves the newest release of ext from its source, or from the
+// release cache if it was fetched recently.
+func latestRelease(ctx context.Context, ext Extension) (*Release, error) {
+	src, err := ext.source()
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	var release extensionRelease
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		return nil, err
+	return cachedLatest(ctx, src)
+}
+
+// updatableExtensions returns the registry entries UpdateAll keeps up to date.
+func updatableExtensions() []Extension {
+	var exts []Extension
+	for _, ext := range registry() {
+		if ext.updatable() {
+			exts = append(exts, ext)
+		}
 	}
-	return &release, nil
+	return exts
 }
 
 // NeedsUpdate checks whether any extension has a newer version available
 // without downloading anything. Used by the unelevated launcher to decide
-// whether to invoke the elevated patcher.
-func NeedsUpdate() bool {
-	for _, ext := range extensions {
-		currentVersion := getInstalledVersion(ext)
-		release, err := fetchLatestRelease(ext)
-		if err != nil {
-			continue
+// whether to invoke the elevated patcher. The sources are queried concurrently,
+// and what they return is cached for UpdateAll.
+func NeedsUpdate(ctx context.Context) bool {
+	var lock map[string]LockEntry
+	if Locked {
+		var err error
+		if lock, err = loadLock(); err != nil {
+			return false
 		}
-		releaseVersion := strings.TrimPrefix(release.TagName, "v")
-		if compareVersions(currentVersion, releaseVersion) < 0 {
+	}
+	claude := ClaudeVersion()
+	cache := loadCompatCache()
+	var needed atomic.Bool
+	forEachConcurrently(updatableExtensions(), func(ext Extension) {
+		if needsUpdate(ctx, ext, lock, claude, cache) {
+			needed.Store(true)
+		}
+	})
+	return needed.Load()
+}
+
+// needsUpdate reports whether UpdateAll would install anything for ext.
+func needsUpdate(ctx context.Context, ext Extension, lock map[string]LockEntry, claude string, cache map[string]map[string]string) bool {
+	currentVersion := getInstalledVersion(ext)
+	if Locked {
+		entry, ok := lock[ext.Folder]
+		return ok && semver.Compare(currentVersion, entry.Version) != 0
+	}
+	release, err := latestRelease(ctx, ext)
+	if err != nil {
+		return false
+	}
+	if release.Version == ext.SkipVersion || semver.Compare(currentVersion, release.Version) >= 0 {
+		return false
+	}
+	if supportsClaude(knownRange(ext, release.Version, cache), claude) {
+		return true
+	}
+	for _, older := range olderReleases(ctx, ext, release, currentVersion) {
+		if supportsClaude(knownRange(ext, older.Version, cache), claude) {
 			return true
 		}
 	}
 	return false
 }
 
-func UpdateAll() error {
+// UpdateAll installs the latest release of every extension that is out of date, or
+// in locked mode exactly the release extensions.lock records. Extensions are checked
+// and downloaded concurrently. It stops early and returns ctx.Err() once ctx is
+// done.
+func UpdateAll(ctx context.Context) error {
 	fmt.Println("Checking extensions...")
 
-	// Create extensions dir if needed
-	os.MkdirAll(utils.ResolveInstallPath("web-extensions"), 0755)
-
-	for _, ext := range extensions {
-		currentVersion := getInstalledVersion(ext)
-
-		release, err := fetchLatestRelease(ext)
-		if err != nil {
-			fmt.Printf("  %s: error checking: %v\n", ext.Folder, err)
-			continue
+	var lock map[string]LockEntry
+	if Locked {
+		var err error
+		if lock, err = loadLock(); err != nil {
+			return err
 		}
+		fmt.Printf("Installing the versions locked in %s\n", LockPath())
+	}
 
-		releaseVersion := strings.TrimPrefix(release.TagName, "v")
+	// Create extensions dir if needed
+	os.MkdirAll(utils.ResolveInstallPath("web-extensions"), 0755)
+	recoverInterruptedUpdates()
 
-		if compareVersions(currentVersion, releaseVersion) >= 0 {
-			fmt.Printf("  %s: up to date (%s)\n", ext.Folder, currentVersion)
-			continue
+	forEachConcurrently(updatableExtensions(), func(ext Extension) {
+		if ctx.Err() != nil {
+			return
 		}
-
-		// Find electron zip
-		downloadURL := ""
-		for _, asset := range release.Assets {
-			if strings.Contains(strings.ToLower(asset.Name), "electron") && strings.HasSuffix(asset.Name, ".zip") {
-				downloadURL = asset.DownloadURL
-				break
-			}
+		var err error
+		if Locked {
+			err = installLocked(ctx, ext, lock)
+		} else {
+			err = updateExtension(ctx, ext)
 		}
-
-		if downloadURL == "" {
-			fmt.Printf("  %s: no electron zip found\n", ext.Folder)
-			continue
-		}
-
-		fmt.Printf("  %s: updating %s -> %s\n", ext.Folder, currentVersion, release.TagName)
-
-		// Download and extract
-		if err := downloadAndExtractExtension(downloadURL, ext.Folder); err != nil {
-			fmt.Printf("  %s: error updating: %v\n", ext.Folder, err)
+		if err != nil {
+			fmt.Printf("  %s: %v\n", ext.Folder, err)
 		}
+	})
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func downloadAndExtractExtension(url, folder string) error {
-	// Download to temp
-	resp, err := http.Get(url)
+// installLocked installs the release extensions.lock pins ext to, upgrading or
+// downgrading as needed.
+func installLocked(ctx context.Context, ext Extension, lock map[string]LockEntry) error {
+	release, err := lockedRelease(ext, lock)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	currentVersion := getInstalledVersion(ext)
+	if semver.Compare(currentVersion, release.Version) == 0 {
+		fmt.Printf("  %s: at locked version (%s)\n", ext.Folder, currentVersion)
+		return nil
+	}
 
-	tempFile := utils.ResolvePath(folder + "-temp.zip")
-	out, _ := os.Create(tempFile)
-	io.Copy(out, resp.Body)
-	out.Close()
-	defer os.Remove(tempFile)
+	fmt.Printf("  %s: installing locked version %s -> %s\n", ext.Folder, currentVersion, release.Version)
+	if err := installRelease(ctx, release, ext, ""); err != nil {
+		return fmt.Errorf("error updating: %v", err)
+	}
+	return nil
+}
 
-	// Remove old and extract new
-	extPath := filepath.Join(utils.ResolveInstallPath("web-extensions"), folder)
-	os.RemoveAll(extPath)
-	os.MkdirAll(extPath, 0755)
+// updateExtension installs the latest release of ext if it is newer than the
+// installed version. If that release doesn't support the installed Claude, it
+// installs the newest older one that does.
+func updateExtension(ctx context.Context, ext Extension) error {
+	currentVersion := getInstalledVersion(ext)
 
-	// Extract zip
-	zipReader, err := zip.OpenReader(tempFile)
+	release, err := latestRelease(ctx, ext)
 	if err != nil {
+		return fmt.Errorf("error checking: %v", err)
+	}
+
+	if semver.Compare(currentVersion, release.Version) >= 0 {
+		fmt.Printf("  %s: up to date (%s)\n", ext.Folder, currentVersion)
+		return nil
+	}
+	if release.Version == ext.SkipVersion {
+		fmt.Printf("  %s: skipping %s (rolled back), staying on %s\n", ext.Folder, release.Version, currentVersion)
+		return nil
+	}
+
+	claude := ClaudeVersion()
+	cache := loadCompatCache()
+	candidates := []*Release{release}
+	for i, downloads := 0, 0; i < len(candidates) && downloads < maxCompatDownloads; i++ {
+		candidate := candidates[i]
+		if rng := knownRange(ext, candidate.Version, cache); !supportsClaude(rng, claude) {
+			fmt.Printf("  %s: %v\n", ext.Folder, &incompatibleError{Version: candidate.Version, Range: rng, Claude: claude})
+		} else {
+			fmt.Printf("  %s: updating %s -> %s\n", ext.Folder, currentVersion, candidate.Tag)
+			downloads++
+			err := installRelease(ctx, candidate, ext, claude)
+			incompatible, ok := err.(*incompatibleError)
+			if !ok {
+				if err != nil {
+					return fmt.Errorf("error updating: %v", err)
+				}
+				return nil
+			}
+			fmt.Printf("  %s: %v\n", ext.Folder, err)
+			rememberRange(ext.Folder, candidate.Version, incompatible.Range)
+		}
+		if i == 0 {
+			candidates = append(candidates, olderReleases(ctx, ext, release, currentVersion)...)
+		}
+	}
+	if currentVersion == "" {
+		return fmt.Errorf("no release supporting Claude %s found", claude)
+	}
+	return fmt.Errorf("no release newer than %s supporting Claude %s found", currentVersion, claude)
+}
+
+// installRelease downloads (or, for local sources, reads) release, unpacks it into
+// the staging folder and swaps it in for web-extensions/<ext.Folder>, keeping the
+// installed version for "ext rollback". The swap only happens if the new version
+// unpacked cleanly, matches the release version and any recorded CRX ID, and
+// supports claude unless that is empty (otherwise an *incompatibleError is
+// returned). Folders the launcher didn't install are never replaced.
+func installRelease(ctx context.Context, release *Release, ext Extension, claude string) error {
+	if err := checkOverwritable(ext.Folder); err != nil {
 		return err
 	}
-	defer zipReader.Close()
 
-	for _, f := range zipReader.File {
-		path := filepath.Join(extPath, f.Name)
+	path := release.LocalPath
+	if path == "" {
+		tempFile := utils.ResolvePath(ext.Folder + "-temp.download")
+		defer os.Remove(tempFile)
+		if err := downloadFile(ctx, release.DownloadURL, tempFile); err != nil {
+			return err
+		}
+		if err := verifyArtifact(ctx, release, ext, tempFile); err != nil {
+			return err
+		}
+		path = tempFile
+	}
 
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(path, 0755)
-			continue
+	if release.SHA256 != "" {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			if err := verifySHA256(path, release.SHA256); err != nil {
+				return err
+			}
 		}
+	}
 
-		os.MkdirAll(filepath.Dir(path), 0755)
+	staged := stagingPath(ext.Folder)
+	os.RemoveAll(staged)
+	defer os.Remove(filepath.Dir(staged)) // only if no other update is staged
+	defer os.RemoveAll(staged)
+	if err := os.MkdirAll(staged, 0755); err != nil {
+		return err
+	}
 
-		src, _ := f.Open()
-		dst, _ := os.Create(path)
-		io.Copy(dst, src)
-		dst.Close()
-		src.Close()
+	id := ext.ExtensionID
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		return err
+	case info.IsDir():
+		err = copyExtensionDir(ctx, path, staged)
+	case isCRXFile(path):
+		id, err = installCRX(ctx, path, staged, ext.ExtensionID)
+	default:
+		err = extractExtensionZip(ctx, path, staged)
+	}
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := validateStaged(staged, release.Version); err != nil {
+		return err
+	}
+	if rng := releaseRange(ext, release.Version, staged); !supportsClaude(rng, claude) {
+		return &incompatibleError{Version: release.Version, Range: rng, Claude: claude}
+	}
+	if err := reviewPermissions(ext, staged); err != nil {
+		return err
+	}
+	source := ext.Source
+	if source == "" {
+		source = release.DownloadURL
+	}
+	if source == "" {
+		source, _ = filepath.Abs(release.LocalPath)
+	}
+	if err := writeMarker(staged, Marker{Source: source, Version: release.Version}); err != nil {
+		return err
+	}
+	if err := swapStaged(ext.Folder); err != nil {
+		return err
 	}
 
+	if id != ext.ExtensionID {
+		fmt.Printf("  %s: extension ID %s\n", ext.Folder, id)
+		return recordExtensionID(ext.Folder, id)
+	}
 	return nil
 }
 
-func compareVersions(v1, v2 string) int {
-	// Split versions and pad to same length
-	parts1 := strings.Split(v1, ".")
-	parts2 := strings.Split(v2, ".")
-
-	// Make both same length
-	maxLen := len(parts1)
-	if len(parts2) > maxLen {
-		maxLen = len(parts2)
+func downloadFile(ctx context.Context, url, dest string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
 	}
 
-	for i := 0; i < maxLen; i++ {
-		// Get digit or 0 if missing
-		digit1 := 0
-		if i < len(parts1) {
-			digit1, _ = strconv.Atoi(parts1[i])
-		}
-
-		digit2 := 0
-		if i < len(parts2) {
-			digit2, _ = strconv.Atoi(parts2[i])
-		}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, resp.Body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
 
-		// Compare
-		if digit1 < digit2 {
-			return -1
-		}
-		if digit1 > digit2 {
-			return 1
-		}
+// isCRXFile reports whether path starts with the CRX magic number.
+func isCRXFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
 	}
+	defer f.Close()
+	magic := make([]byte, len(crxMagic))
+	_, err = io.ReadFull(f, magic)
+	return err == nil && string(magic) == crxMagic
+}
+
+// maxExtensionSize caps how much an extension archive may extract to.
+const maxExtensionSize = 512 << 20
 
-	return 0 // Equal
+// extractExtensionZip extracts zipPath into dest.
+func extractExtensionZip(ctx context.Context, zipPath, dest string) error {
+	return utils.ExtractZip(ctx, zipPath, dest, utils.ExtractOptions{MaxSize: maxExtensionSize})
 }
@@ -0,0 +1,103 @@
+package extensions
+
+import (
+	"claude-webext-patcher/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// The wrapper reports how each extension fared in status/<instance>.json next to
+// the launcher: whether it loaded, and whether its content scripts ran on
+// claude.ai. The launcher prints the report on the next launch.
+
+// Load states reported in ExtensionStatus.
+const (
+	StatusLoaded = "loaded"
+	StatusFailed = "failed"
+)
+
+// ExtensionStatus is one extension's entry in the status file.
+type ExtensionStatus struct {
+	Status string `json:"status"`
+	// Error is why the extension failed to load.
+	Error string `json:"error,omitempty"`
+	// ContentScripts reports whether the extension declares content scripts, and
+	// ContentScriptRan whether one of them was seen running in claude.ai.
+	ContentScripts   bool `json:"content_scripts"`
+	ContentScriptRan bool `json:"content_script_ran"`
+}
+
+// InstanceStatus is the content of status/<instance>.json.
+type InstanceStatus struct {
+	UpdatedAt  time.Time                  `json:"updated_at"`
+	Extensions map[string]ExtensionStatus `json:"extensions"`
+}
+
+// StatusDir returns the folder the wrapper writes status files to.
+func StatusDir() string {
+	return utils.ResolvePath("status")
+}
+
+// ReadStatus returns the status the wrapper last reported for instance, or nil if
+// there is none.
+func ReadStatus(instance string) (*InstanceStatus, error) {
+	if _, err := instancePath(instance); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(StatusDir(), instance+".json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var status InstanceStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("parsing the status of instance %s: %v", instance, err)
+	}
+	return &status, nil
+}
+
+// Describe summarizes s, e.g. "loaded, content script ran".
+func (s ExtensionStatus) Describe() string {
+	switch {
+	case s.Status == StatusFailed && s.Error != "":
+		return "failed to load: " + s.Error
+	case s.Status != StatusLoaded:
+		return s.Status
+	case !s.ContentScripts:
+		return "loaded"
+	case s.ContentScriptRan:
+		return "loaded, content script ran"
+	}
+	return "loaded, content script not seen"
+}
+
+// PrintStatus prints the status the wrapper reported on instance's last launch.
+func PrintStatus(instance string) {
+	status, err := ReadStatus(instance)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return
+	}
+	if status == nil {
+		return
+	}
+	fmt.Printf("Extensions on the last launch of %s (%s):\n", instance, status.UpdatedAt.Local().Format("2006-01-02 15:04"))
+	if len(status.Extensions) == 0 {
+		fmt.Println("  none loaded")
+		return
+	}
+	folders := make([]string, 0, len(status.Extensions))
+	for folder := range status.Extensions {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+	for _, folder := range folders {
+		fmt.Printf("  %s: %s\n", folder, status.Extensions[folder].Describe())
+	}
+}
@@ -0,0 +1,20 @@
+package extensions
+
+import "testing"
+
+func TestDescribeStatus(t *testing.T) {
+	for _, tc := range []struct {
+		status ExtensionStatus
+		want   string
+	}{
+		{ExtensionStatus{Status: StatusLoaded, ContentScripts: true, ContentScriptRan: true}, "loaded, content script ran"},
+		{ExtensionStatus{Status: StatusLoaded, ContentScripts: true}, "loaded, content script not seen"},
+		{ExtensionStatus{Status: StatusLoaded}, "loaded"},
+		{ExtensionStatus{Status: StatusFailed, Error: "bad manifest"}, "failed to load: bad manifest"},
+		{ExtensionStatus{Status: StatusFailed}, "failed"},
+	} {
+		if got := tc.status.Describe(); got != tc.want {
+			t.Errorf("Describe(%+v) = %q, want %q", tc.status, got, tc.want)
+		}
+	}
+}
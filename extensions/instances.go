@@ -0,0 +1,152 @@
+package extensions
+
+import (
+	"claude-webext-patcher/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// InstanceEnvVar passes an instance's extension set to the wrapper when the launcher
+// starts Claude: a JSON array of the folders to load. When it isn't set, the wrapper
+// loads every enabled extension. The sentinel and the instance's own theme are
+// always loaded.
+const InstanceEnvVar = "CLAUDE_WEBEXT_EXTENSIONS"
+
+// instanceFile is instances/<name>.json.
+type instanceFile struct {
+	Extensions []string `json:"extensions"`
+}
+
+// InstancesDir returns the folder holding the per-instance extension sets.
+func InstancesDir() string {
+	return utils.ResolvePath("instances")
+}
+
+func instancePath(instance string) (string, error) {
+	if instance == "" || strings.ContainsAny(instance, `/\:`) || instance == "." || instance == ".." {
+		return "", fmt.Errorf("invalid instance name %q", instance)
+	}
+	return filepath.Join(InstancesDir(), instance+".json"), nil
+}
+
+// InstanceExtensions returns the folders instance loads. ok is false when the
+// instance has no set and loads every extension.
+func InstanceExtensions(instance string) (folders []string, ok bool, err error) {
+	path, err := instancePath(instance)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var f instanceFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, false, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	if f.Extensions == nil {
+		f.Extensions = []string{}
+	}
+	return f.Extensions, true, nil
+}
+
+// setInstanceExtensions writes instance's set.
+func setInstanceExtensions(instance string, folders []string) error {
+	path, err := instancePath(instance)
+	if err != nil {
+		return err
+	}
+	sort.Strings(folders)
+	data, err := json.MarshalIndent(instanceFile{Extensions: folders}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(InstancesDir(), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// AddToInstance adds folders to instance's set. An instance without a set starts
+// from an empty one, so it then loads only these folders.
+func AddToInstance(instance string, folders ...string) error {
+	current, _, err := InstanceExtensions(instance)
+	if err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	for _, folder := range current {
+		set[folder] = true
+	}
+	for _, folder := range folders {
+		if err := checkFolderName(folder); err != nil {
+			return err
+		}
+		if _, err := os.Stat(filepath.Join(extensionsDir(), folder, "manifest.json")); err != nil {
+			fmt.Printf("Warning: %s is not installed yet\n", folder)
+		}
+		if !set[folder] {
+			set[folder] = true
+			current = append(current, folder)
+		}
+	}
+	return setInstanceExtensions(instance, current)
+}
+
+// RemoveFromInstance removes folders from instance's set.
+func RemoveFromInstance(instance string, folders ...string) error {
+	current, ok, err := InstanceExtensions(instance)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("instance %s loads every extension; add the ones it should load instead", instance)
+	}
+	remove := map[string]bool{}
+	for _, folder := range folders {
+		remove[folder] = true
+	}
+	kept := []string{}
+	for _, folder := range current {
+		if !remove[folder] {
+			kept = append(kept, folder)
+		}
+	}
+	if len(kept) == len(current) {
+		return fmt.Errorf("none of %s are in the set of instance %s", strings.Join(folders, ", "), instance)
+	}
+	return setInstanceExtensions(instance, kept)
+}
+
+// ResetInstance deletes instance's set, so it loads every extension again.
+func ResetInstance(instance string) error {
+	path, err := instancePath(instance)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// InstanceEnv returns the InstanceEnvVar assignment ("NAME=value") to start
+// instance with, or "" if it loads every extension.
+func InstanceEnv(instance string) (string, error) {
+	folders, ok, err := InstanceExtensions(instance)
+	if err != nil || !ok {
+		return "", err
+	}
+	data, err := json.Marshal(folders)
+	if err != nil {
+		return "", err
+	}
+	return InstanceEnvVar + "=" + string(data), nil
+}
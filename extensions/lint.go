@@ -0,0 +1,304 @@
+package extensions
+
+import (
+	"claude-webext-patcher/protocol"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Support levels reported by Lint.
+const (
+	SupportNative      = "native"      // implemented by Electron
+	SupportPolyfilled  = "polyfilled"  // emulated by the launcher's wrapper
+	SupportUnsupported = "unsupported" // will be undefined or fail at runtime
+)
+
+// apiMembers lists the supported members of an API namespace; nil means all of them.
+type apiMembers map[string]bool
+
+func members(names ...string) apiMembers {
+	m := apiMembers{}
+	for _, n := range names {
+		m[n] = true
+	}
+	return m
+}
+
+// electronAPIs are the extension APIs Electron implements, per its "Chrome Extension
+// Support" documentation.
+var electronAPIs = map[string]apiMembers{
+	"devtools":   nil,
+	"extension":  members("lastError", "getURL", "getBackgroundPage"),
+	"i18n":       nil,
+	"management": members("getAll", "get", "getSelf", "getPermissionWarningsById", "getPermissionWarningsByManifest", "onEnabled", "onDisabled"),
+	"runtime": members("id", "lastError", "getBackgroundPage", "getManifest", "getPlatformInfo", "getURL",
+		"connect", "sendMessage", "reload", "onStartup", "onInstalled", "onSuspend", "onSuspendCanceled",
+		"onConnect", "onMessage"),
+	"scripting":  nil,
+	"storage":    members("local", "session", "onChanged"),
+	"tabs":       members("get", "connect", "executeScript", "sendMessage", "reload", "update", "query"),
+	"webRequest": nil,
+}
+
+// wrapperPolyfills are the APIs the wrapper emulates through its console protocol.
+// Extensions reach them through the shim "ext adapt" adds, so they are only
+// available to extensions that load it.
+var wrapperPolyfills = func() map[string]apiMembers {
+	m := map[string]apiMembers{}
+	for namespace, names := range protocol.Polyfills {
+		m[namespace] = members(names...)
+	}
+	return m
+}()
+
+// harmlessPermissions don't correspond to an API namespace that could be missing.
+var harmlessPermissions = members("activeTab", "unlimitedStorage", "<all_urls>")
+
+// APIUse is one chrome.*/browser.* API referenced by an extension's scripts.
+type APIUse struct {
+	API     string // e.g. "chrome.storage.local"
+	Support string
+	// Hint says how an unsupported API could become available.
+	Hint  string
+	Count int
+	Files []string // relative to the extension folder
+}
+
+// LintReport describes how well an extension fits the Electron host.
+type LintReport struct {
+	Name            string
+	Version         string
+	ManifestVersion int
+	APIs            []APIUse
+	// ManifestIssues are manifest features Claude Desktop can't provide.
+	ManifestIssues []string
+}
+
+// Unsupported reports whether the extension uses anything that will fail.
+func (r *LintReport) Unsupported() bool {
+	for _, api := range r.APIs {
+		if api.Support == SupportUnsupported {
+			return true
+		}
+	}
+	return len(r.ManifestIssues) > 0
+}
+
+// adaptHint is the Hint of polyfilled APIs used by an extension without the shim.
+const adaptHint = "available after ext adapt"
+
+// apiUsePattern matches chrome.ns.member and browser.ns.member, including optional
+// chaining, but not as a property of something else (e.g. "options.browser.x").
+var apiUsePattern = regexp.MustCompile(`(?:^|[^.\w$])(chrome|browser)\??\.([A-Za-z]+)(?:\??\.([A-Za-z]+))?`)
+
+// Lint parses the manifest.json in dir and scans the extension's scripts for
+// chrome.*/browser.* API usage.
+func Lint(dir string) (*LintReport, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest.json: %v", err)
+	}
+	var manifest map[string]json.RawMessage
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parsing manifest.json: %v", err)
+	}
+	report := &LintReport{}
+	json.Unmarshal(manifest["name"], &report.Name)
+	json.Unmarshal(manifest["version"], &report.Version)
+	json.Unmarshal(manifest["manifest_version"], &report.ManifestVersion)
+	shimmed := loadsShim(manifest)
+	report.ManifestIssues = lintManifest(manifest, shimmed)
+
+	uses := map[string]*APIUse{}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		rel, _ := filepath.Rel(dir, path)
+		// The adapt shim implements the polyfilled APIs rather than using them.
+		if info.IsDir() || (ext != ".js" && ext != ".mjs") || rel == ShimFile {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		src, err := io.ReadAll(io.LimitReader(f, 16<<20))
+		f.Close()
+		if err != nil {
+			return err
+		}
+		for _, m := range apiUsePattern.FindAllStringSubmatch(string(src), -1) {
+			namespace, member := m[2], m[3]
+			api := "chrome." + namespace
+			if member != "" {
+				api += "." + member
+			}
+			use := uses[api]
+			if use == nil {
+				use = &APIUse{API: api, Support: apiSupport(namespace, member, shimmed)}
+				if use.Support == SupportUnsupported && polyfilled(namespace, member) {
+					use.Hint = adaptHint
+				}
+				uses[api] = use
+			}
+			use.Count++
+			if len(use.Files) == 0 || use.Files[len(use.Files)-1] != filepath.ToSlash(rel) {
+				use.Files = append(use.Files, filepath.ToSlash(rel))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, use := range uses {
+		report.APIs = append(report.APIs, *use)
+	}
+	sort.Slice(report.APIs, func(i, j int) bool { return report.APIs[i].API < report.APIs[j].API })
+	return report, nil
+}
+
+// apiSupport classifies chrome.<namespace>.<member> for an extension that loads the
+// adapt shim or not. A bare namespace reference is classified by whether anything
+// in it is available.
+func apiSupport(namespace, member string, shimmed bool) string {
+	switch {
+	case lookupAPI(electronAPIs, namespace, member):
+		return SupportNative
+	case shimmed && polyfilled(namespace, member):
+		return SupportPolyfilled
+	}
+	return SupportUnsupported
+}
+
+func lookupAPI(table map[string]apiMembers, namespace, member string) bool {
+	m, ok := table[namespace]
+	return ok && (m == nil || member == "" || m[member])
+}
+
+// polyfilled reports whether the wrapper emulates chrome.<namespace>.<member>.
+func polyfilled(namespace, member string) bool {
+	return lookupAPI(wrapperPolyfills, namespace, member)
+}
+
+// loadsShim reports whether one of the manifest's content scripts loads the adapt
+// shim.
+func loadsShim(manifest map[string]json.RawMessage) bool {
+	var contentScripts []struct {
+		JS []string `json:"js"`
+	}
+	json.Unmarshal(manifest["content_scripts"], &contentScripts)
+	for _, cs := range contentScripts {
+		for _, js := range cs.JS {
+			if js == ShimFile {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// permissionSupport classifies a manifest permission by the API it unlocks.
+// Host patterns and harmlessPermissions count as native.
+func permissionSupport(p string, shimmed bool) string {
+	if harmlessPermissions[p] || strings.Contains(p, "://") {
+		return SupportNative
+	}
+	return apiSupport(permissionNamespace(p), "", shimmed)
+}
+
+func permissionNamespace(p string) string {
+	return strings.SplitN(p, ".", 2)[0]
+}
+
+// actionKeys hold the toolbar button, whose default_popup has nowhere to open.
+var actionKeys = []string{"action", "browser_action", "page_action"}
+
+// unsupportedManifestKeys are manifest features Claude Desktop has no UI for, with
+// the reason.
+var unsupportedManifestKeys = map[string]string{
+	"options_page":         "there is no extensions page to open it from",
+	"options_ui":           "there is no extensions page to open it from",
+	"commands":             "keyboard shortcuts are not registered",
+	"omnibox":              "there is no address bar",
+	"side_panel":           "side panels are not supported",
+	"chrome_url_overrides": "Chrome pages can't be overridden",
+}
+
+func lintManifest(manifest map[string]json.RawMessage, shimmed bool) []string {
+	var issues []string
+	if _, ok := manifest["manifest_version"]; !ok {
+		issues = append(issues, "manifest_version is missing")
+	}
+
+	var permissions []string
+	json.Unmarshal(manifest["permissions"], &permissions)
+	for _, p := range permissions {
+		if permissionSupport(p, shimmed) == SupportUnsupported {
+			issue := fmt.Sprintf("permission %q: the %s API is not available", p, permissionNamespace(p))
+			if polyfilled(permissionNamespace(p), "") {
+				issue += " (" + adaptHint + ")"
+			}
+			issues = append(issues, issue)
+		}
+	}
+
+	for _, key := range actionKeys {
+		var action struct {
+			DefaultPopup string `json:"default_popup"`
+		}
+		if json.Unmarshal(manifest[key], &action) == nil && action.DefaultPopup != "" {
+			issues = append(issues, fmt.Sprintf("%s.default_popup: there is no toolbar to open the popup from", key))
+		}
+	}
+	for key, why := range unsupportedManifestKeys {
+		if _, ok := manifest[key]; ok {
+			issues = append(issues, fmt.Sprintf("%s: %s", key, why))
+		}
+	}
+	sort.Strings(issues)
+	return issues
+}
+
+// PrintLintReport writes a report the way the ext commands print everything else.
+func PrintLintReport(w io.Writer, r *LintReport) {
+	fmt.Fprintf(w, "%s %s (manifest v%d)\n", r.Name, r.Version, r.ManifestVersion)
+	sections := []struct{ support, title string }{
+		{SupportNative, "Supported by Electron"},
+		{SupportPolyfilled, "Polyfilled by the launcher (through the ext adapt shim)"},
+		{SupportUnsupported, "Will fail"},
+	}
+	for _, s := range sections {
+		var lines []string
+		for _, api := range r.APIs {
+			if api.Support == s.support {
+				line := fmt.Sprintf("    %s (%d use(s) in %s)", api.API, api.Count, strings.Join(api.Files, ", "))
+				if api.Hint != "" {
+					line += "; " + api.Hint
+				}
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			fmt.Fprintf(w, "  %s:\n%s\n", s.title, strings.Join(lines, "\n"))
+		}
+	}
+	if len(r.ManifestIssues) > 0 {
+		fmt.Fprintf(w, "  Manifest:\n")
+		for _, issue := range r.ManifestIssues {
+			fmt.Fprintf(w, "    %s\n", issue)
+		}
+	}
+	if len(r.APIs) == 0 && len(r.ManifestIssues) == 0 {
+		fmt.Fprintf(w, "  No extension API usage found.\n")
+	}
+}
@@ -0,0 +1,180 @@
+package extensions
+
+import (
+	"claude-webext-patcher/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Locked makes UpdateAll install exactly the versions recorded in extensions.lock
+// instead of the latest releases. Set by the main package from config.json.
+var Locked bool
+
+// LockEntry pins one extension to a release artifact.
+type LockEntry struct {
+	Source  string `json:"source"`
+	Version string `json:"version"`
+	// URL is the artifact's download URL, or its path for local sources.
+	URL string `json:"url"`
+	// SHA256 is the artifact's hex digest. Unpacked local folders have none.
+	SHA256 string `json:"sha256,omitempty"`
+	// SignatureURL is the release's signature, checked when the extension has a
+	// public_key.
+	SignatureURL string `json:"signature_url,omitempty"`
+}
+
+type lockFile struct {
+	// Extensions is keyed by folder.
+	Extensions map[string]LockEntry `json:"extensions"`
+}
+
+// LockPath returns the location of extensions.lock, next to extensions.json.
+func LockPath() string {
+	return utils.ResolveInstallPath("extensions.lock")
+}
+
+func loadLock() (map[string]LockEntry, error) {
+	data, err := os.ReadFile(LockPath())
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("locked mode is on but %s does not exist; run \"ext lock\" first", LockPath())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", LockPath(), err)
+	}
+	var f lockFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", LockPath(), err)
+	}
+	return f.Extensions, nil
+}
+
+// lockedRelease returns the release extensions.lock pins ext to.
+func lockedRelease(ext Extension, lock map[string]LockEntry) (*Release, error) {
+	entry, ok := lock[ext.Folder]
+	if !ok {
+		return nil, fmt.Errorf("not in %s", LockPath())
+	}
+	if entry.Source != ext.Source {
+		return nil, fmt.Errorf("locked to source %s, but the registry says %s", entry.Source, ext.Source)
+	}
+	release := &Release{
+		Version:      entry.Version,
+		Tag:          entry.Version,
+		SHA256:       entry.SHA256,
+		SignatureURL: entry.SignatureURL,
+	}
+	if strings.HasPrefix(ext.Source, "local:") {
+		release.LocalPath = entry.URL
+	} else {
+		release.DownloadURL = entry.URL
+	}
+	return release, nil
+}
+
+// Lock resolves the latest release of every enabled extension with a source,
+// downloads it to compute its SHA-256, and rewrites extensions.lock. Extensions that
+// fail keep their previous lock entry.
+func Lock(ctx context.Context) error {
+	lock := map[string]LockEntry{}
+	if data, err := os.ReadFile(LockPath()); err == nil {
+		var f lockFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			return fmt.Errorf("parsing %s: %v", LockPath(), err)
+		}
+		if f.Extensions != nil {
+			lock = f.Extensions
+		}
+	}
+
+	exts, err := LoadRegistry()
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, ext := range exts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !ext.updatable() {
+			continue
+		}
+		entry, err := lockEntryFor(ctx, ext)
+		if err != nil {
+			fmt.Printf("  %s: %v\n", ext.Folder, err)
+			failed++
+			continue
+		}
+		fmt.Printf("  %s: %s\n", ext.Folder, entry.Version)
+		lock[ext.Folder] = *entry
+	}
+
+	data, err := json.MarshalIndent(lockFile{Extensions: lock}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(LockPath(), data, 0644); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d extension(s) could not be locked", failed)
+	}
+	return nil
+}
+
+func lockEntryFor(ctx context.Context, ext Extension) (*LockEntry, error) {
+	release, err := latestRelease(ctx, ext)
+	if err != nil {
+		return nil, err
+	}
+	entry := &LockEntry{Source: ext.Source, Version: release.Version, URL: release.DownloadURL, SignatureURL: release.SignatureURL}
+	if release.LocalPath != "" {
+		entry.URL = release.LocalPath
+		if info, err := os.Stat(release.LocalPath); err == nil && info.IsDir() {
+			return entry, nil
+		}
+		entry.SHA256, err = fileSHA256(release.LocalPath)
+		return entry, err
+	}
+
+	tempFile := utils.ResolvePath(ext.Folder + "-lock.download")
+	defer os.Remove(tempFile)
+	if err := downloadFile(ctx, release.DownloadURL, tempFile); err != nil {
+		return nil, err
+	}
+	if err := verifyArtifact(ctx, release, ext, tempFile); err != nil {
+		return nil, err
+	}
+	entry.SHA256, err = fileSHA256(tempFile)
+	return entry, err
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifySHA256 checks the file at path against a hex digest.
+func verifySHA256(path, want string) error {
+	got, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(got, want) {
+		return fmt.Errorf("SHA-256 mismatch: expected %s, got %s", want, got)
+	}
+	return nil
+}
@@ -0,0 +1,419 @@
+package extensions
+
+import (
+	"claude-webext-patcher/utils"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SentinelFolder is the launcher's own health-check extension. It is deployed on
+// every run and can't be managed with the ext commands.
+const SentinelFolder = "sentinel"
+
+// Origins reported in Info.
+const (
+	OriginBuiltin    = "built-in"   // a built-in registry entry
+	OriginManaged    = "managed"    // a registry entry added to extensions.json
+	OriginAdded      = "added"      // installed once with "ext add"
+	OriginUserscript = "userscript" // generated from the userscripts folder
+	OriginTheme      = "theme"      // generated from the themes folder
+	OriginManual     = "manual"     // put in web-extensions by hand
+	OriginDev        = "dev"        // linked with "ext dev"
+)
+
+// Info describes an extension for "ext list".
+type Info struct {
+	Folder  string
+	Version string // from manifest.json; empty if not installed
+	// Source is the registry source, or for installed extensions the one their
+	// marker records.
+	Source  string
+	Enabled bool
+	// Origin says how the extension got there; see the Origin constants.
+	Origin string
+	// InstalledAt is when the launcher installed it; zero if unknown.
+	InstalledAt time.Time
+	// Installed reports whether the folder exists in web-extensions.
+	Installed bool
+	// Incompatible reports that the installed version doesn't support the
+	// installed Claude.
+	Incompatible bool
+}
+
+// List returns every extension in the registry and every folder in web-extensions,
+// sorted by folder name.
+func List() ([]Info, error) {
+	exts, err := LoadRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	builtin := map[string]bool{}
+	for _, ext := range builtinExtensions {
+		builtin[ext.Folder] = true
+	}
+	byFolder := map[string]*Info{}
+	for _, ext := range exts {
+		info := &Info{Folder: ext.Folder, Source: ext.Source, Enabled: ext.Enabled}
+		switch {
+		case ext.Source == "":
+		case builtin[ext.Folder]:
+			info.Origin = OriginBuiltin
+		default:
+			info.Origin = OriginManaged
+		}
+		byFolder[ext.Folder] = info
+	}
+
+	entries, _ := os.ReadDir(extensionsDir())
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == SentinelFolder {
+			continue
+		}
+		if _, ok := byFolder[entry.Name()]; !ok {
+			byFolder[entry.Name()] = &Info{Folder: entry.Name(), Enabled: true}
+		}
+	}
+	// Dev links are symlinks, which ReadDir doesn't report as folders.
+	devLinks := loadDevLinks()
+	for folder := range devLinks {
+		if _, ok := byFolder[folder]; !ok {
+			byFolder[folder] = &Info{Folder: folder, Enabled: true}
+		}
+	}
+
+	registered := map[string]Extension{}
+	for _, ext := range exts {
+		registered[ext.Folder] = ext
+	}
+	claude := ClaudeVersion()
+	infos := make([]Info, 0, len(byFolder))
+	for folder, info := range byFolder {
+		dir := filepath.Join(extensionsDir(), folder)
+		if _, err := os.Stat(filepath.Join(dir, "manifest.json")); err == nil {
+			info.Installed = true
+			info.Version = getInstalledVersion(Extension{Folder: folder})
+			ext, ok := registered[folder]
+			if !ok {
+				ext = Extension{Folder: folder}
+			}
+			info.Incompatible = installedIncompatibility(ext, claude) != nil
+			marker := readMarker(dir)
+			if marker != nil {
+				info.InstalledAt = marker.InstalledAt
+			}
+			// A managed entry whose folder the user put there is still theirs.
+			if info.Origin == "" || marker == nil {
+				info.Origin = markerOrigin(marker)
+				if marker != nil && info.Source == "" {
+					info.Source = marker.Source
+				}
+			}
+		}
+		if link, ok := devLinks[folder]; ok {
+			info.Origin, info.Source = OriginDev, link.Path
+		}
+		if info.Origin == "" {
+			info.Origin = OriginManual
+		}
+		infos = append(infos, *info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Folder < infos[j].Folder })
+	return infos, nil
+}
+
+// markerOrigin classifies an extension that isn't a managed registry entry.
+func markerOrigin(m *Marker) string {
+	switch {
+	case m == nil:
+		return OriginManual
+	case strings.HasPrefix(m.Source, UserscriptSource):
+		return OriginUserscript
+	case strings.HasPrefix(m.Source, ThemeSource):
+		return OriginTheme
+	}
+	return OriginAdded
+}
+
+var githubRepoPattern = regexp.MustCompile(`^[\w.-]+/[\w.-]+$`)
+
+// AddOptions are the optional settings for Add.
+type AddOptions struct {
+	// Folder is the name in web-extensions; derived from the spec when empty.
+	Folder string
+	// AssetPattern, VersionURL and PublicKey are stored in the registry entry of an
+	// updatable source.
+	AssetPattern string
+	VersionURL   string
+	PublicKey    string
+}
+
+// Add installs an extension from spec. A source spec (see sourcePrefixes, or a bare
+// GitHub "owner/repo") is added to the registry and kept up to date; an http(s) URL
+// of a zip, or a local folder or zip, is installed once as a user-added extension.
+// It returns the folder the extension was installed to.
+func Add(ctx context.Context, spec string, opts AddOptions) (string, error) {
+	isURL := strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://")
+	_, statErr := os.Stat(spec)
+	isPath := statErr == nil
+	// A relative path such as "dir/ext" also looks like owner/repo; the path wins.
+	isSource := !isURL && isSourceSpec(spec) && (!isPath || strings.Contains(spec, ":"))
+	if !isURL && !isPath && !isSource {
+		return "", fmt.Errorf("%q is not a source, a URL or an existing path", spec)
+	}
+
+	// Updates run from other working directories, e.g. the elevated patcher's.
+	if path, ok := strings.CutPrefix(spec, "local:"); ok {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+		spec = "local:" + abs
+	}
+
+	ext := Extension{
+		Source:       spec,
+		AssetPattern: opts.AssetPattern,
+		VersionURL:   opts.VersionURL,
+		PublicKey:    opts.PublicKey,
+		Enabled:      true,
+	}
+	if isSource {
+		if _, err := ext.source(); err != nil {
+			return "", err
+		}
+	}
+
+	folder := opts.Folder
+	if folder == "" {
+		folder = defaultFolder(spec)
+	}
+	if err := checkFolderName(folder); err != nil {
+		return "", err
+	}
+	exts, err := LoadRegistry()
+	if err != nil {
+		return "", err
+	}
+	for _, ext := range exts {
+		if ext.Folder == folder {
+			return "", fmt.Errorf("an extension named %s is already registered", folder)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(extensionsDir(), folder)); err == nil {
+		return "", fmt.Errorf("%s already exists", filepath.Join(extensionsDir(), folder))
+	}
+
+	os.MkdirAll(extensionsDir(), 0755)
+
+	var installErr error
+	switch {
+	case isSource:
+		ext.Folder = folder
+		// The entry goes in first so installing can record the extension ID on it.
+		if installErr = addRegistryEntry(ext); installErr == nil {
+			if installErr = updateExtension(ctx, ext); installErr != nil {
+				removeRegistryEntry(folder)
+			}
+		}
+	case isURL:
+		installErr = installRelease(ctx, &Release{DownloadURL: spec}, Extension{Folder: folder}, "")
+	default:
+		installErr = installRelease(ctx, &Release{LocalPath: spec}, Extension{Folder: folder}, "")
+	}
+	if installErr != nil {
+		return "", installErr
+	}
+	return folder, nil
+}
+
+// Remove deletes an extension's folder and its registry entry. Built-in extensions
+// can only be disabled.
+func Remove(folder string) error {
+	if err := checkFolderName(folder); err != nil {
+		return err
+	}
+	for _, ext := range builtinExtensions {
+		if ext.Folder == folder {
+			return fmt.Errorf("%s is built in and can't be removed; use \"ext disable %s\" instead", folder, folder)
+		}
+	}
+
+	if _, ok := loadDevLinks()[folder]; ok {
+		return unlinkDev(folder)
+	}
+
+	found, err := removeRegistryEntry(folder)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(extensionsDir(), folder)
+	if _, err := os.Stat(dir); err == nil {
+		found = true
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	os.RemoveAll(previousPath(folder))
+	if !found {
+		return fmt.Errorf("no extension named %s", folder)
+	}
+	return nil
+}
+
+// removeRegistryEntry drops folder's entry from extensions.json, reporting whether
+// there was one.
+func removeRegistryEntry(folder string) (bool, error) {
+	user, err := loadRegistryFile()
+	if err != nil {
+		return false, err
+	}
+	found := false
+	kept := user[:0]
+	for _, ext := range user {
+		if ext.Folder == folder {
+			found = true
+			continue
+		}
+		kept = append(kept, ext)
+	}
+	if !found {
+		return false, nil
+	}
+	return true, saveRegistryFile(kept)
+}
+
+// SetEnabled enables or disables an extension. Disabled extensions stay on disk but
+// are neither updated nor loaded.
+func SetEnabled(folder string, enabled bool) error {
+	if err := checkFolderName(folder); err != nil {
+		return err
+	}
+	exts, err := LoadRegistry()
+	if err != nil {
+		return err
+	}
+	known := false
+	for _, ext := range exts {
+		known = known || ext.Folder == folder
+	}
+	if _, err := os.Stat(filepath.Join(extensionsDir(), folder)); err == nil {
+		known = true
+	}
+	if !known {
+		return fmt.Errorf("no extension named %s", folder)
+	}
+
+	return updateRegistryEntry(folder, func(e *Extension) { e.Enabled = enabled })
+}
+
+// recordExtensionID stores the CRX extension ID of folder in extensions.json.
+func recordExtensionID(folder, id string) error {
+	return updateRegistryEntry(folder, func(e *Extension) { e.ExtensionID = id })
+}
+
+// registryMu serializes updateRegistryEntry across concurrent updates.
+var registryMu sync.Mutex
+
+// updateRegistryEntry applies fn to folder's entry in extensions.json, adding an
+// entry that only carries the change if there is none.
+func updateRegistryEntry(folder string, fn func(*Extension)) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	user, err := loadRegistryFile()
+	if err != nil {
+		return err
+	}
+	for i := range user {
+		if user[i].Folder == folder {
+			fn(&user[i])
+			return saveRegistryFile(user)
+		}
+	}
+	entry := Extension{Folder: folder, Enabled: true}
+	fn(&entry)
+	return saveRegistryFile(append(user, entry))
+}
+
+func addRegistryEntry(ext Extension) error {
+	user, err := loadRegistryFile()
+	if err != nil {
+		return err
+	}
+	return saveRegistryFile(append(user, ext))
+}
+
+// FolderPath returns where the extension in folder is installed.
+func FolderPath(folder string) string {
+	return filepath.Join(extensionsDir(), folder)
+}
+
+func extensionsDir() string {
+	return utils.ResolveInstallPath("web-extensions")
+}
+
+// defaultFolder derives a folder name from an add spec: the repository name, or the
+// file name without its extension.
+func defaultFolder(spec string) string {
+	name := strings.TrimRight(spec, "/\\")
+	if i := strings.LastIndexAny(name, "/\\"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	return strings.ToLower(name)
+}
+
+func checkFolderName(folder string) error {
+	if folder == "" || folder == "." || folder == ".." || strings.ContainsAny(folder, `/\:`) {
+		return fmt.Errorf("invalid extension folder name %q", folder)
+	}
+	if folder == SentinelFolder {
+		return fmt.Errorf("%s is managed by the launcher", SentinelFolder)
+	}
+	return nil
+}
+
+// copyExtensionDir copies a local unpacked extension into dst.
+func copyExtensionDir(ctx context.Context, src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, in)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	})
+}
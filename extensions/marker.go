@@ -0,0 +1,116 @@
+package extensions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MarkerFile is the marker every folder the launcher installs or generates carries,
+// recording where it came from. Folders without one were put there by the user,
+// and the launcher never overwrites them.
+const MarkerFile = ".launcher-managed.json"
+
+// Marker sources of generated extensions are prefixed with what generated them.
+const (
+	UserscriptSource = "userscript:"
+	ThemeSource      = "theme:"
+)
+
+// Marker is the content of a folder's .launcher-managed.json.
+type Marker struct {
+	// Source is the registry source, download URL or path the extension was
+	// installed from, or userscript:<file> / theme:<name> for generated ones.
+	Source      string    `json:"source"`
+	Version     string    `json:"version"`
+	InstalledAt time.Time `json:"installed_at"`
+	// Adopted is set on folders that were claimed with "ext adopt".
+	Adopted bool `json:"adopted,omitempty"`
+}
+
+// readMarker returns the marker in dir, or nil if there is none.
+func readMarker(dir string) *Marker {
+	data, err := os.ReadFile(filepath.Join(dir, MarkerFile))
+	if err != nil {
+		return nil
+	}
+	var m Marker
+	if json.Unmarshal(data, &m) != nil {
+		return nil
+	}
+	return &m
+}
+
+// writeMarker records that dir was installed from source.
+func writeMarker(dir string, m Marker) error {
+	if m.InstalledAt.IsZero() {
+		m.InstalledAt = time.Now().UTC().Truncate(time.Second)
+	}
+	if m.Version == "" {
+		m.Version = manifestVersion(dir)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, MarkerFile), data, 0644)
+}
+
+// checkOverwritable refuses to replace web-extensions/<folder> if it exists and
+// the launcher didn't put it there.
+func checkOverwritable(folder string) error {
+	dir := filepath.Join(extensionsDir(), folder)
+	if _, err := os.Stat(dir); err != nil {
+		return nil
+	}
+	if readMarker(dir) == nil {
+		return fmt.Errorf("%s was not installed by the launcher, so it won't be overwritten; remove it, or run \"ext adopt %s\" to let the launcher manage it", dir, folder)
+	}
+	return nil
+}
+
+// generatedBy reports whether dir was generated by the sync whose marker sources
+// start with prefix. Folders generated before markers existed are recognized by
+// legacyFile.
+func generatedBy(dir, prefix, legacyFile string) bool {
+	if m := readMarker(dir); m != nil {
+		return strings.HasPrefix(m.Source, prefix)
+	}
+	_, err := os.Stat(filepath.Join(dir, legacyFile))
+	return err == nil
+}
+
+// isUserFolder reports whether web-extensions/<folder> exists but wasn't generated
+// by the sync generatedBy(prefix, legacyFile) describes.
+func isUserFolder(folder, prefix, legacyFile string) bool {
+	dir := filepath.Join(extensionsDir(), folder)
+	if _, err := os.Stat(dir); err != nil {
+		return false
+	}
+	return !generatedBy(dir, prefix, legacyFile)
+}
+
+// Adopt marks an existing folder as installed by the launcher, so updates from its
+// registry entry may replace it.
+func Adopt(folder string) error {
+	if err := checkFolderName(folder); err != nil {
+		return err
+	}
+	dir := filepath.Join(extensionsDir(), folder)
+	if _, err := os.Stat(filepath.Join(dir, "manifest.json")); err != nil {
+		return fmt.Errorf("%s is not an installed extension", folder)
+	}
+	if m := readMarker(dir); m != nil {
+		return fmt.Errorf("%s is already managed by the launcher (source %s)", folder, m.Source)
+	}
+	source := ""
+	for _, ext := range registry() {
+		if ext.Folder == folder {
+			source = ext.Source
+		}
+	}
+	return writeMarker(dir, Marker{Source: source, Adopted: true})
+}
@@ -0,0 +1,142 @@
+package extensions
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Grants are labelled "permission:<name>", "host:<pattern>" and
+// "content_script:<pattern>" so the three kinds can be told apart in prompts and in
+// the approved set.
+const (
+	grantPermission    = "permission:"
+	grantHost          = "host:"
+	grantContentScript = "content_script:"
+)
+
+// manifestGrants returns the sorted grants requested by the manifest in dir:
+// permissions, host permissions (MV3 host_permissions, or URL patterns listed in MV2
+// permissions) and content script matches.
+func manifestGrants(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	var manifest struct {
+		Permissions     []string `json:"permissions"`
+		HostPermissions []string `json:"host_permissions"`
+		ContentScripts  []struct {
+			Matches []string `json:"matches"`
+		} `json:"content_scripts"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parsing manifest.json: %v", err)
+	}
+
+	set := map[string]bool{}
+	for _, p := range manifest.Permissions {
+		if p == "<all_urls>" || strings.Contains(p, "://") {
+			set[grantHost+p] = true
+		} else {
+			set[grantPermission+p] = true
+		}
+	}
+	for _, h := range manifest.HostPermissions {
+		set[grantHost+h] = true
+	}
+	for _, cs := range manifest.ContentScripts {
+		for _, m := range cs.Matches {
+			set[grantContentScript+m] = true
+		}
+	}
+
+	grants := make([]string, 0, len(set))
+	for g := range set {
+		grants = append(grants, g)
+	}
+	sort.Strings(grants)
+	return grants, nil
+}
+
+// reviewPermissions compares the grants requested by the staged version of ext with
+// the ones already approved (or, before anything was recorded, the installed
+// version's). New grants must be approved at the console; without a console they
+// are refused. The approved set is recorded in the extension's registry entry.
+func reviewPermissions(ext Extension, staged string) error {
+	requested, err := manifestGrants(staged)
+	if err != nil {
+		return err
+	}
+
+	known := map[string]bool{}
+	approved := ext.ApprovedPermissions
+	if approved == nil {
+		approved, _ = manifestGrants(filepath.Join(extensionsDir(), ext.Folder))
+	}
+	for _, g := range approved {
+		known[g] = true
+	}
+	var added []string
+	for _, g := range requested {
+		if !known[g] {
+			added = append(added, g)
+		}
+	}
+
+	if len(added) > 0 {
+		// Concurrent updates take turns at the console.
+		promptMu.Lock()
+		defer promptMu.Unlock()
+		fmt.Printf("  %s requests new permissions:\n", ext.Folder)
+		for _, g := range added {
+			fmt.Printf("    %s\n", g)
+		}
+		if !stdinIsTerminal() {
+			return fmt.Errorf("new permissions need approval; run the launcher from a terminal to review them")
+		}
+		if !confirm("  Allow? [y/N] ") {
+			return fmt.Errorf("new permissions were not approved")
+		}
+	}
+
+	if equalStrings(requested, ext.ApprovedPermissions) {
+		return nil
+	}
+	return updateRegistryEntry(ext.Folder, func(e *Extension) { e.ApprovedPermissions = requested })
+}
+
+// promptMu keeps permission prompts from concurrent updates apart.
+var promptMu sync.Mutex
+
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func confirm(prompt string) bool {
+	fmt.Print(prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		fmt.Println()
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) || (a == nil) != (b == nil) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
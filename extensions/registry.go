@@ -0,0 +1,176 @@
+package extensions
+
+import (
+	"claude-webext-patcher/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// defaultAssetPattern matches the Electron build zip that lugia19's extensions publish.
+const defaultAssetPattern = `(?i)electron.*\.zip$`
+
+// Extension is one entry of the extension registry.
+type Extension struct {
+	// Source is where releases come from; see sourcePrefixes for the accepted forms.
+	// Entries without a source only carry settings (such as Enabled) for a folder the
+	// user manages.
+	Source string `json:"source,omitempty"`
+	// Folder is the extension's folder name inside web-extensions.
+	Folder string `json:"folder"`
+	// AssetPattern is a regular expression selecting the release asset to install.
+	// Empty means defaultAssetPattern.
+	AssetPattern string `json:"asset_pattern,omitempty"`
+	// VersionURL publishes the current version for "url:" sources.
+	VersionURL string `json:"version_url,omitempty"`
+	// ExtensionID is the Chrome extension ID of a CRX-packaged extension, recorded on
+	// first install. Updates must be signed with the same key.
+	ExtensionID string `json:"extension_id,omitempty"`
+	// PublicKey is a minisign or base64 ed25519 public key. When set, every download
+	// must carry a valid signature from it.
+	PublicKey string `json:"public_key,omitempty"`
+	// ApprovedPermissions are the grants (see manifestGrants) the user approved; an
+	// update requesting anything else needs approval again.
+	ApprovedPermissions []string `json:"approved_permissions,omitempty"`
+	// ClaudeWebext declares which Claude versions the extension's releases support,
+	// for extensions whose manifest doesn't; see CompatRule.
+	ClaudeWebext []CompatRule `json:"claude_webext,omitempty"`
+	// SkipVersion is a version "ext rollback" moved away from; updates skip it.
+	SkipVersion string `json:"skip_version,omitempty"`
+	// Enabled extensions are kept up to date. Defaults to true.
+	Enabled bool `json:"enabled"`
+}
+
+func (e *Extension) UnmarshalJSON(data []byte) error {
+	type plain Extension
+	p := plain{Enabled: true}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*e = Extension(p)
+	return nil
+}
+
+// builtinExtensions are always present in the registry unless overridden by folder.
+var builtinExtensions = []Extension{
+	{Source: "lugia19/Claude-Usage-Extension", Folder: "usage-tracker", Enabled: true},
+	{Source: "lugia19/Claude-Toolbox", Folder: "userscript-toolbox", Enabled: true},
+}
+
+type registryFile struct {
+	Extensions []Extension `json:"extensions"`
+}
+
+// RegistryPath returns the location of extensions.json, next to the install.
+func RegistryPath() string {
+	return utils.ResolveInstallPath("extensions.json")
+}
+
+// LoadRegistry returns the built-in extensions merged with extensions.json. An entry
+// in the file whose folder matches a built-in overrides it field by field; other
+// entries are appended in file order.
+func LoadRegistry() ([]Extension, error) {
+	user, err := loadRegistryFile()
+	if err != nil {
+		return nil, err
+	}
+	return mergeRegistry(builtinExtensions, user), nil
+}
+
+// registry is LoadRegistry for callers that can carry on with the built-ins alone.
+func registry() []Extension {
+	exts, err := LoadRegistry()
+	if err != nil {
+		fmt.Printf("Warning: %v; using built-in extensions only\n", err)
+		return mergeRegistry(builtinExtensions, nil)
+	}
+	return exts
+}
+
+func loadRegistryFile() ([]Extension, error) {
+	data, err := os.ReadFile(RegistryPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", RegistryPath(), err)
+	}
+	var f registryFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", RegistryPath(), err)
+	}
+	for _, e := range f.Extensions {
+		if e.Folder == "" {
+			return nil, fmt.Errorf("%s: entry with source %q has no folder", RegistryPath(), e.Source)
+		}
+	}
+	return f.Extensions, nil
+}
+
+func saveRegistryFile(exts []Extension) error {
+	data, err := json.MarshalIndent(registryFile{Extensions: exts}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(RegistryPath(), data, 0644)
+}
+
+func mergeRegistry(defaults, user []Extension) []Extension {
+	merged := make([]Extension, 0, len(defaults)+len(user))
+	index := map[string]int{}
+	for _, e := range defaults {
+		index[e.Folder] = len(merged)
+		merged = append(merged, e)
+	}
+	for _, e := range user {
+		i, ok := index[e.Folder]
+		if !ok {
+			index[e.Folder] = len(merged)
+			merged = append(merged, e)
+			continue
+		}
+		base := merged[i]
+		if e.Source != "" {
+			base.Source = e.Source
+		}
+		if e.AssetPattern != "" {
+			base.AssetPattern = e.AssetPattern
+		}
+		if e.VersionURL != "" {
+			base.VersionURL = e.VersionURL
+		}
+		if e.ExtensionID != "" {
+			base.ExtensionID = e.ExtensionID
+		}
+		if e.PublicKey != "" {
+			base.PublicKey = e.PublicKey
+		}
+		// An explicit empty list clears the built-in rules.
+		if e.ClaudeWebext != nil {
+			base.ClaudeWebext = e.ClaudeWebext
+		}
+		base.SkipVersion = e.SkipVersion
+		base.ApprovedPermissions = e.ApprovedPermissions
+		base.Enabled = e.Enabled
+		merged[i] = base
+	}
+	return merged
+}
+
+func (e Extension) assetPattern() (*regexp.Regexp, error) {
+	pattern := e.AssetPattern
+	if pattern == "" {
+		pattern = defaultAssetPattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid asset_pattern %q: %v", pattern, err)
+	}
+	return re, nil
+}
+
+// updatable reports whether UpdateAll should manage this entry.
+func (e Extension) updatable() bool {
+	return e.Enabled && e.Source != ""
+}
@@ -0,0 +1,443 @@
+package extensions
+
+import (
+	"archive/zip"
+	"claude-webext-patcher/semver"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Release is the newest version of an extension offered by a Source.
+type Release struct {
+	// Version is the release version without a leading "v".
+	Version string
+	// Tag is the release name as published (e.g. "v1.2.0").
+	Tag string
+	// AssetName and DownloadURL identify the artifact to install. Local sources set
+	// LocalPath instead.
+	AssetName   string
+	DownloadURL string
+	LocalPath   string
+	// SHA256, if set, is the artifact's expected hex digest.
+	SHA256 string
+	// ChecksumURL is a published checksum for the artifact: a .sha256 file, or a
+	// sha256sum-style list when ChecksumList is set. SignatureURL is a minisign or
+	// raw ed25519 signature of it.
+	ChecksumURL  string
+	ChecksumList bool
+	SignatureURL string
+}
+
+// Beta makes sources offer prereleases: the newest release by version, instead of
+// the one the forge marks as latest.
+var Beta bool
+
+// Source resolves the latest release of an extension.
+type Source interface {
+	Latest(ctx context.Context) (*Release, error)
+	String() string
+}
+
+// releaseLister is implemented by sources that publish a list of past releases, so
+// updates can fall back to an older one that supports the installed Claude. Releases
+// returns them newest first, prereleases only in the beta channel.
+type releaseLister interface {
+	Releases(ctx context.Context) ([]*Release, error)
+}
+
+// The source field of a registry entry is "owner/repo" (GitHub) or one of:
+//
+//	github:owner/repo
+//	gitea:https://host/owner/repo     (Gitea, Forgejo)
+//	gitlab:https://host/group/project (GitLab, including nested groups)
+//	url:https://host/ext.zip          (fixed zip; version_url gives the version)
+//	local:/path/to/folder-or.zip
+var sourcePrefixes = []string{"github:", "gitea:", "gitlab:", "url:", "local:"}
+
+// isSourceSpec reports whether spec names an updatable source.
+func isSourceSpec(spec string) bool {
+	for _, prefix := range sourcePrefixes {
+		if strings.HasPrefix(spec, prefix) {
+			return true
+		}
+	}
+	return githubRepoPattern.MatchString(spec)
+}
+
+// source parses the entry's Source field.
+func (e Extension) source() (Source, error) {
+	spec := e.Source
+	switch {
+	case strings.HasPrefix(spec, "github:"), githubRepoPattern.MatchString(spec):
+		repo := strings.TrimPrefix(spec, "github:")
+		if !githubRepoPattern.MatchString(repo) {
+			return nil, fmt.Errorf("source %q is not of the form github:owner/repo", spec)
+		}
+		pattern, err := e.assetPattern()
+		if err != nil {
+			return nil, err
+		}
+		return &releaseAPISource{
+			name:     "github:" + repo,
+			latest:   "https://api.github.com/repos/" + repo + "/releases/latest",
+			releases: "https://api.github.com/repos/" + repo + "/releases?per_page=30",
+			pattern:  pattern,
+		}, nil
+
+	case strings.HasPrefix(spec, "gitea:"):
+		host, repo, err := splitRepoURL(strings.TrimPrefix(spec, "gitea:"))
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := e.assetPattern()
+		if err != nil {
+			return nil, err
+		}
+		// Gitea's release API mirrors GitHub's.
+		return &releaseAPISource{
+			name:     spec,
+			latest:   host + "/api/v1/repos/" + repo + "/releases/latest",
+			releases: host + "/api/v1/repos/" + repo + "/releases?limit=30",
+			pattern:  pattern,
+		}, nil
+
+	case strings.HasPrefix(spec, "gitlab:"):
+		host, project, err := splitRepoURL(strings.TrimPrefix(spec, "gitlab:"))
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := e.assetPattern()
+		if err != nil {
+			return nil, err
+		}
+		return &gitlabSource{
+			name:     spec,
+			latest:   host + "/api/v4/projects/" + url.PathEscape(project) + "/releases/permalink/latest",
+			releases: host + "/api/v4/projects/" + url.PathEscape(project) + "/releases?per_page=30",
+			pattern:  pattern,
+		}, nil
+
+	case strings.HasPrefix(spec, "url:"):
+		zipURL := strings.TrimPrefix(spec, "url:")
+		if !strings.HasPrefix(zipURL, "http://") && !strings.HasPrefix(zipURL, "https://") {
+			return nil, fmt.Errorf("source %q is not an http(s) URL", spec)
+		}
+		if e.VersionURL == "" {
+			return nil, fmt.Errorf("source %q needs a version_url", spec)
+		}
+		return &urlSource{zipURL: zipURL, versionURL: e.VersionURL}, nil
+
+	case strings.HasPrefix(spec, "local:"):
+		return &localSource{path: strings.TrimPrefix(spec, "local:")}, nil
+	}
+	return nil, fmt.Errorf("unrecognized source %q", spec)
+}
+
+// splitRepoURL splits "https://host/owner/repo" into "https://host" and "owner/repo".
+func splitRepoURL(raw string) (string, string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", "", fmt.Errorf("%q is not an http(s) repository URL", raw)
+	}
+	repo := strings.Trim(strings.TrimSuffix(u.Path, ".git"), "/")
+	if strings.Count(repo, "/") < 1 {
+		return "", "", fmt.Errorf("%q does not name a repository", raw)
+	}
+	return u.Scheme + "://" + u.Host, repo, nil
+}
+
+// releaseAPISource reads a GitHub-style "latest release" endpoint, or in the beta
+// channel the list of releases.
+type releaseAPISource struct {
+	name     string
+	latest   string
+	releases string
+	pattern  *regexp.Regexp
+}
+
+// apiRelease is a release as the GitHub and Gitea APIs describe it.
+type apiRelease struct {
+	TagName    string `json:"tag_name"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+	Assets     []struct {
+		Name        string `json:"name"`
+		DownloadURL string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (s *releaseAPISource) String() string { return s.name }
+
+func (s *releaseAPISource) Latest(ctx context.Context) (*Release, error) {
+	if !Beta {
+		var release apiRelease
+		if err := getJSON(ctx, s.latest, &release); err != nil {
+			return nil, err
+		}
+		return s.pick(release)
+	}
+	releases, err := s.Releases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newestRelease(releases, s.pattern)
+}
+
+func (s *releaseAPISource) Releases(ctx context.Context) ([]*Release, error) {
+	var releases []apiRelease
+	if err := getJSON(ctx, s.releases, &releases); err != nil {
+		return nil, err
+	}
+	var candidates []*Release
+	for _, release := range releases {
+		if release.Draft || (!Beta && (release.Prerelease || semver.IsPrerelease(release.TagName))) {
+			continue
+		}
+		if r, err := s.pick(release); err == nil {
+			candidates = append(candidates, r)
+		}
+	}
+	return sortReleases(candidates), nil
+}
+
+// pick selects the asset of release that matches s.pattern.
+func (s *releaseAPISource) pick(release apiRelease) (*Release, error) {
+	assets := map[string]string{}
+	for _, asset := range release.Assets {
+		assets[asset.Name] = asset.DownloadURL
+	}
+	for _, asset := range release.Assets {
+		if s.pattern.MatchString(asset.Name) {
+			r := &Release{
+				Version:     strings.TrimPrefix(release.TagName, "v"),
+				Tag:         release.TagName,
+				AssetName:   asset.Name,
+				DownloadURL: asset.DownloadURL,
+			}
+			r.attachVerification(assets)
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("release %s has no asset matching %s", release.TagName, s.pattern)
+}
+
+// gitlabSource reads GitLab's latest-release permalink, or in the beta channel the
+// list of releases. Release files are asset links.
+type gitlabSource struct {
+	name     string
+	latest   string
+	releases string
+	pattern  *regexp.Regexp
+}
+
+// gitlabRelease is a release as the GitLab API describes it.
+type gitlabRelease struct {
+	TagName         string `json:"tag_name"`
+	UpcomingRelease bool   `json:"upcoming_release"`
+	Assets          struct {
+		Links []struct {
+			Name           string `json:"name"`
+			URL            string `json:"url"`
+			DirectAssetURL string `json:"direct_asset_url"`
+		} `json:"links"`
+	} `json:"assets"`
+}
+
+func (s *gitlabSource) String() string { return s.name }
+
+func (s *gitlabSource) Latest(ctx context.Context) (*Release, error) {
+	if !Beta {
+		var release gitlabRelease
+		if err := getJSON(ctx, s.latest, &release); err != nil {
+			return nil, err
+		}
+		return s.pick(release)
+	}
+	releases, err := s.Releases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newestRelease(releases, s.pattern)
+}
+
+func (s *gitlabSource) Releases(ctx context.Context) ([]*Release, error) {
+	var releases []gitlabRelease
+	if err := getJSON(ctx, s.releases, &releases); err != nil {
+		return nil, err
+	}
+	var candidates []*Release
+	for _, release := range releases {
+		if release.UpcomingRelease || (!Beta && semver.IsPrerelease(release.TagName)) {
+			continue
+		}
+		if r, err := s.pick(release); err == nil {
+			candidates = append(candidates, r)
+		}
+	}
+	return sortReleases(candidates), nil
+}
+
+// pick selects the asset link of release that matches s.pattern.
+func (s *gitlabSource) pick(release gitlabRelease) (*Release, error) {
+	assets := map[string]string{}
+	for _, link := range release.Assets.Links {
+		assets[link.Name] = link.DirectAssetURL
+		if assets[link.Name] == "" {
+			assets[link.Name] = link.URL
+		}
+	}
+	for _, link := range release.Assets.Links {
+		if !s.pattern.MatchString(link.Name) {
+			continue
+		}
+		r := &Release{
+			Version:     strings.TrimPrefix(release.TagName, "v"),
+			Tag:         release.TagName,
+			AssetName:   link.Name,
+			DownloadURL: assets[link.Name],
+		}
+		r.attachVerification(assets)
+		return r, nil
+	}
+	return nil, fmt.Errorf("release %s has no asset matching %s", release.TagName, s.pattern)
+}
+
+// newestRelease returns the first of releases, sorted by sortReleases.
+func newestRelease(releases []*Release, pattern *regexp.Regexp) (*Release, error) {
+	if len(releases) == 0 {
+		return nil, fmt.Errorf("no release has an asset matching %s", pattern)
+	}
+	return releases[0], nil
+}
+
+// sortReleases sorts releases newest first by version.
+func sortReleases(releases []*Release) []*Release {
+	sort.SliceStable(releases, func(i, j int) bool {
+		return semver.Compare(releases[i].Version, releases[j].Version) > 0
+	})
+	return releases
+}
+
+// urlSource is a zip at a fixed URL whose current version is published separately,
+// either as plain text or as JSON with a "version" key (such as the extension's
+// manifest.json).
+type urlSource struct {
+	zipURL     string
+	versionURL string
+}
+
+func (s *urlSource) String() string { return "url:" + s.zipURL }
+
+func (s *urlSource) Latest(ctx context.Context) (*Release, error) {
+	data, err := getBody(ctx, s.versionURL)
+	if err != nil {
+		return nil, err
+	}
+	version := strings.TrimSpace(string(data))
+	var manifest struct {
+		Version string `json:"version"`
+	}
+	if json.Unmarshal(data, &manifest) == nil && manifest.Version != "" {
+		version = manifest.Version
+	}
+	if version == "" || strings.ContainsAny(version, " \n{") {
+		return nil, fmt.Errorf("%s does not contain a version", s.versionURL)
+	}
+	return &Release{
+		Version:     strings.TrimPrefix(version, "v"),
+		Tag:         version,
+		AssetName:   filepath.Base(s.zipURL),
+		DownloadURL: s.zipURL,
+	}, nil
+}
+
+// localSource is an unpacked extension folder or a zip on disk; its version is the
+// one in its manifest.json.
+type localSource struct {
+	path string
+}
+
+func (s *localSource) String() string { return "local:" + s.path }
+
+func (s *localSource) Latest(ctx context.Context) (*Release, error) {
+	var data []byte
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		data, err = os.ReadFile(filepath.Join(s.path, "manifest.json"))
+	} else {
+		data, err = readZipFile(s.path, "manifest.json")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest.json from %s: %v", s.path, err)
+	}
+	var manifest struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil || manifest.Version == "" {
+		return nil, fmt.Errorf("%s: manifest.json has no version", s.path)
+	}
+	return &Release{
+		Version:   manifest.Version,
+		Tag:       manifest.Version,
+		AssetName: filepath.Base(s.path),
+		LocalPath: s.path,
+	}, nil
+}
+
+func readZipFile(zipPath, name string) ([]byte, error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(rc)
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+func getBody(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	data, err := getBody(ctx, url)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parsing %s: %v", url, err)
+	}
+	return nil
+}
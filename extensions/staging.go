@@ -0,0 +1,120 @@
+package extensions
+
+import (
+	"claude-webext-patcher/semver"
+	"claude-webext-patcher/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// New versions are unpacked into extensions-staging/<folder> and only swapped into
+// web-extensions once they look valid. The version they replace is kept in
+// extensions-previous/<folder> for "ext rollback".
+func stagingPath(folder string) string {
+	return filepath.Join(utils.ResolveInstallPath("extensions-staging"), folder)
+}
+
+func previousPath(folder string) string {
+	return filepath.Join(utils.ResolveInstallPath("extensions-previous"), folder)
+}
+
+// validateStaged checks that dir holds a parseable manifest.json and, when
+// wantVersion is set, that it declares that version. Manifests can't carry a
+// prerelease part, so a 1.2.0-beta.3 release must declare 1.2.0.
+func validateStaged(dir, wantVersion string) error {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return fmt.Errorf("no manifest.json at the top level of the package")
+	}
+	var manifest struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("parsing manifest.json: %v", err)
+	}
+	if manifest.Version == "" {
+		return fmt.Errorf("manifest.json has no version")
+	}
+	if wantVersion != "" && semver.Compare(manifest.Version, semver.Core(wantVersion)) != 0 {
+		return fmt.Errorf("manifest.json declares version %s, but the release is %s", manifest.Version, wantVersion)
+	}
+	return nil
+}
+
+// swapStaged moves the installed folder to extensions-previous and the staged one
+// into its place. If the staged folder can't be moved in, the installed one is put
+// back.
+func swapStaged(folder string) error {
+	live := filepath.Join(extensionsDir(), folder)
+	previous := previousPath(folder)
+
+	movedAside := false
+	if _, err := os.Stat(live); err == nil {
+		os.RemoveAll(previous)
+		os.MkdirAll(filepath.Dir(previous), 0755)
+		if err := os.Rename(live, previous); err != nil {
+			return fmt.Errorf("moving the installed version aside: %v", err)
+		}
+		movedAside = true
+	}
+	if err := os.Rename(stagingPath(folder), live); err != nil {
+		if movedAside {
+			os.Rename(previous, live)
+		}
+		return fmt.Errorf("installing the new version: %v", err)
+	}
+	return nil
+}
+
+// recoverInterruptedUpdates removes leftover staging folders and restores any
+// extension that was moved aside by an update that never finished swapping.
+func recoverInterruptedUpdates() {
+	os.RemoveAll(utils.ResolveInstallPath("extensions-staging"))
+
+	entries, _ := os.ReadDir(utils.ResolveInstallPath("extensions-previous"))
+	for _, entry := range entries {
+		live := filepath.Join(extensionsDir(), entry.Name())
+		if _, err := os.Stat(live); os.IsNotExist(err) {
+			fmt.Printf("  %s: restoring after an interrupted update\n", entry.Name())
+			os.Rename(previousPath(entry.Name()), live)
+		}
+	}
+}
+
+// Rollback swaps an extension with the version it replaced, so running it again
+// undoes the rollback. A managed extension then skips the version rolled back from
+// until a newer one is released. It returns the restored version.
+func Rollback(folder string) (string, error) {
+	if err := checkFolderName(folder); err != nil {
+		return "", err
+	}
+	live := filepath.Join(extensionsDir(), folder)
+	previous := previousPath(folder)
+	if _, err := os.Stat(previous); err != nil {
+		return "", fmt.Errorf("no previous version of %s to roll back to", folder)
+	}
+	rolledBackFrom := getInstalledVersion(Extension{Folder: folder})
+
+	// Rotate live -> staging, previous -> live, staging -> previous.
+	temp := stagingPath(folder)
+	os.RemoveAll(temp)
+	os.MkdirAll(filepath.Dir(temp), 0755)
+	if err := os.Rename(live, temp); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("moving the installed version aside: %v", err)
+	}
+	if err := os.Rename(previous, live); err != nil {
+		os.Rename(temp, live)
+		return "", fmt.Errorf("restoring the previous version: %v", err)
+	}
+	os.Rename(temp, previous)
+
+	restored := getInstalledVersion(Extension{Folder: folder})
+	if rolledBackFrom != "" && rolledBackFrom != restored {
+		if err := updateRegistryEntry(folder, func(e *Extension) { e.SkipVersion = rolledBackFrom }); err != nil {
+			return restored, err
+		}
+	}
+	return restored, nil
+}
@@ -0,0 +1,157 @@
+package extensions
+
+import (
+	"bytes"
+	"claude-webext-patcher/utils"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Themes are .css files in the themes folder. The theme selected for an instance is
+// packaged as a content-script extension in web-extensions/theme-<instance>, which
+// the wrapper only loads for that instance, so switching themes regenerates that one
+// folder and never needs a re-patch.
+const (
+	// ThemeFolderPrefix starts the folder name of every generated theme extension.
+	ThemeFolderPrefix = "theme-"
+	// NoTheme selects no theme.
+	NoTheme = "none"
+
+	themeFile = "theme.css"
+)
+
+// ThemesDir returns the folder themes are picked up from.
+func ThemesDir() string {
+	return utils.ResolvePath("themes")
+}
+
+// Themes returns the names of the available themes.
+func Themes() ([]string, error) {
+	entries, err := os.ReadDir(ThemesDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".css") {
+			names = append(names, strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// themeFolder returns the folder of instance's theme extension.
+func themeFolder(instance string) (string, error) {
+	folder := ThemeFolderPrefix + instance
+	if err := checkFolderName(folder); err != nil {
+		return "", fmt.Errorf("instance name %q can't have a theme: %v", instance, err)
+	}
+	return folder, nil
+}
+
+// themeFiles builds the extension for theme, or returns nil for no theme.
+func themeFiles(theme string) (map[string][]byte, error) {
+	if theme == "" || theme == NoTheme {
+		return nil, nil
+	}
+	if strings.ContainsAny(theme, `/\`) {
+		return nil, fmt.Errorf("invalid theme name %q", theme)
+	}
+	css, err := os.ReadFile(filepath.Join(ThemesDir(), theme+".css"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			available, _ := Themes()
+			return nil, fmt.Errorf("theme %q not found in %s (available: %s)", theme, ThemesDir(), strings.Join(append(available, NoTheme), ", "))
+		}
+		return nil, err
+	}
+
+	manifest, err := json.MarshalIndent(map[string]interface{}{
+		"manifest_version": 3,
+		"name":             "Theme: " + theme,
+		"version":          "1.0",
+		"description":      "Generated by the launcher from themes/" + theme + ".css",
+		"content_scripts": []map[string]interface{}{{
+			"matches": []string{"https://claude.ai/*"},
+			"css":     []string{themeFile},
+			"run_at":  "document_start",
+		}},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{"manifest.json": manifest, themeFile: css}, nil
+}
+
+// ThemeChanged reports whether SyncTheme(instance, theme) has anything to do. Used
+// by the unelevated launcher to decide whether to invoke the elevated patcher.
+func ThemeChanged(instance, theme string) bool {
+	folder, err := themeFolder(instance)
+	if err != nil {
+		return false
+	}
+	files, err := themeFiles(theme)
+	if err != nil {
+		return false
+	}
+	return !themeUpToDate(filepath.Join(extensionsDir(), folder), files)
+}
+
+// themeUpToDate reports whether dir holds exactly files and its marker, or doesn't
+// exist when files is nil.
+func themeUpToDate(dir string, files map[string][]byte) bool {
+	if files == nil {
+		_, err := os.Stat(dir)
+		return os.IsNotExist(err)
+	}
+	if readMarker(dir) == nil {
+		return false
+	}
+	for name, data := range files {
+		existing, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || !bytes.Equal(existing, data) {
+			return false
+		}
+	}
+	return true
+}
+
+// SyncTheme regenerates instance's theme extension for theme, removing it when
+// theme is "" or NoTheme.
+func SyncTheme(instance, theme string) error {
+	folder, err := themeFolder(instance)
+	if err != nil {
+		return err
+	}
+	files, err := themeFiles(theme)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(extensionsDir(), folder)
+	if themeUpToDate(dir, files) {
+		return nil
+	}
+	if isUserFolder(folder, ThemeSource, themeFile) {
+		return fmt.Errorf("%s was not generated by the launcher and won't be replaced", dir)
+	}
+
+	if files == nil {
+		fmt.Printf("Removing the theme of instance %s\n", instance)
+		return os.RemoveAll(dir)
+	}
+	fmt.Printf("Applying theme %s to instance %s\n", theme, instance)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return fmt.Errorf("writing %s: %v", filepath.Join(folder, name), err)
+		}
+	}
+	return writeMarker(dir, Marker{Source: ThemeSource + theme})
+}
@@ -0,0 +1,383 @@
+package extensions
+
+import (
+	"bufio"
+	"bytes"
+	"claude-webext-patcher/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Userscripts dropped into the userscripts folder are each turned into a Manifest V3
+// content-script extension in web-extensions/userscript-<name>, where <name> comes
+// from the file name. The folder holds the generated manifest.json, a copy of the
+// script and a marker; folders whose script has been deleted are removed again.
+const (
+	userscriptPrefix = "userscript-"
+	userscriptFile   = "script.user.js"
+)
+
+// UserscriptsDir returns the folder userscripts are picked up from.
+func UserscriptsDir() string {
+	return utils.ResolvePath("userscripts")
+}
+
+// userscriptMeta is the part of a ==UserScript== block the launcher understands.
+type userscriptMeta struct {
+	Name           string
+	Version        string
+	Description    string
+	RunAt          string
+	Matches        []string
+	ExcludeMatches []string
+	// Ignored are the metadata keys that have no content-script equivalent.
+	Ignored []string
+}
+
+var userscriptLine = regexp.MustCompile(`^//\s*@([\w:-]+)(?:\s+(.*))?$`)
+
+// parseUserscript reads the ==UserScript== metadata block at the top of src.
+func parseUserscript(src []byte) (*userscriptMeta, error) {
+	meta := &userscriptMeta{}
+	inBlock, closed := false, false
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "// ==UserScript==":
+			inBlock = true
+			continue
+		case line == "// ==/UserScript==":
+			closed = inBlock
+		}
+		if closed {
+			break
+		}
+		if !inBlock {
+			continue
+		}
+		m := userscriptLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		key, value := m[1], strings.TrimSpace(m[2])
+		switch key {
+		case "name":
+			meta.Name = value
+		case "version":
+			meta.Version = value
+		case "description":
+			meta.Description = value
+		case "run-at":
+			meta.RunAt = value
+		case "match":
+			meta.Matches = append(meta.Matches, value)
+		case "exclude-match":
+			meta.ExcludeMatches = append(meta.ExcludeMatches, value)
+		case "grant":
+			if value != "none" {
+				meta.Ignored = append(meta.Ignored, "@grant "+value)
+			}
+		case "include", "exclude", "require", "resource":
+			meta.Ignored = append(meta.Ignored, "@"+key)
+		}
+	}
+	if !closed {
+		return nil, fmt.Errorf("no ==UserScript== block")
+	}
+	if len(meta.Matches) == 0 {
+		return nil, fmt.Errorf("no @match")
+	}
+	return meta, nil
+}
+
+// userscriptRunAt maps @run-at onto content_scripts run_at.
+var userscriptRunAt = map[string]string{
+	"":               "document_idle",
+	"document-start": "document_start",
+	"document-body":  "document_end",
+	"document-end":   "document_end",
+	"document-idle":  "document_idle",
+}
+
+var manifestVersionPattern = regexp.MustCompile(`^\d+(\.\d+){0,3}`)
+
+// userscriptManifest builds the manifest.json of the extension generated from a
+// script called file.
+func userscriptManifest(file string, meta *userscriptMeta) ([]byte, error) {
+	runAt, ok := userscriptRunAt[meta.RunAt]
+	if !ok {
+		return nil, fmt.Errorf("unsupported @run-at %q", meta.RunAt)
+	}
+	name := meta.Name
+	if name == "" {
+		name = file
+	}
+	// Chrome only accepts up to four dot-separated integers, so "1.2-beta" is 1.2.
+	version := manifestVersionPattern.FindString(meta.Version)
+	if version == "" {
+		version = "1.0"
+	}
+	description := meta.Description
+	if description == "" {
+		description = "Generated by the launcher from userscripts/" + file
+	}
+
+	type contentScript struct {
+		Matches        []string `json:"matches"`
+		ExcludeMatches []string `json:"exclude_matches,omitempty"`
+		JS             []string `json:"js"`
+		RunAt          string   `json:"run_at"`
+	}
+	manifest := struct {
+		ManifestVersion int             `json:"manifest_version"`
+		Name            string          `json:"name"`
+		Version         string          `json:"version"`
+		Description     string          `json:"description"`
+		ContentScripts  []contentScript `json:"content_scripts"`
+	}{
+		ManifestVersion: 3,
+		Name:            name,
+		Version:         version,
+		Description:     description,
+		ContentScripts: []contentScript{{
+			Matches:        meta.Matches,
+			ExcludeMatches: meta.ExcludeMatches,
+			JS:             []string{userscriptFile},
+			RunAt:          runAt,
+		}},
+	}
+	return json.MarshalIndent(manifest, "", "  ")
+}
+
+// generatedUserscript is the extension generated for one userscript.
+type generatedUserscript struct {
+	Script   string // file name in UserscriptsDir
+	Files    map[string][]byte
+	Warnings []string
+}
+
+var slugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// generateUserscripts builds the extension for every script in UserscriptsDir,
+// keyed by folder. Scripts that can't be converted are reported in problems.
+func generateUserscripts() (generated map[string]*generatedUserscript, problems []string) {
+	generated = map[string]*generatedUserscript{}
+	entries, err := os.ReadDir(UserscriptsDir())
+	if err != nil {
+		return generated, nil
+	}
+
+	reserved := map[string]bool{}
+	for _, ext := range registry() {
+		if ext.Source != "" {
+			reserved[ext.Folder] = true
+		}
+	}
+
+	for _, entry := range entries {
+		file := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(strings.ToLower(file), ".user.js") {
+			continue
+		}
+		slug := strings.Trim(slugPattern.ReplaceAllString(strings.ToLower(file[:len(file)-len(".user.js")]), "-"), "-")
+		folder := userscriptPrefix + slug
+		switch {
+		case slug == "":
+			problems = append(problems, fmt.Sprintf("%s: can't derive a folder name from the file name", file))
+			continue
+		case reserved[folder]:
+			problems = append(problems, fmt.Sprintf("%s: %s is already used by a managed extension; rename the file", file, folder))
+			continue
+		case generated[folder] != nil:
+			problems = append(problems, fmt.Sprintf("%s: %s is already generated from %s; rename the file", file, folder, generated[folder].Script))
+			continue
+		case isUserFolder(folder, UserscriptSource, userscriptFile):
+			problems = append(problems, fmt.Sprintf("%s: %s was not generated by the launcher and won't be overwritten; rename the file", file, folder))
+			continue
+		}
+
+		script, err := os.ReadFile(filepath.Join(UserscriptsDir(), file))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", file, err))
+			continue
+		}
+		meta, err := parseUserscript(script)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", file, err))
+			continue
+		}
+		manifest, err := userscriptManifest(file, meta)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", file, err))
+			continue
+		}
+		g := &generatedUserscript{
+			Script: file,
+			Files:  map[string][]byte{"manifest.json": manifest, userscriptFile: script},
+		}
+		for _, ignored := range meta.Ignored {
+			g.Warnings = append(g.Warnings, ignored+" is not supported and was ignored")
+		}
+		generated[folder] = g
+	}
+	return generated, problems
+}
+
+// staleUserscriptFolders returns the generated folders in web-extensions whose
+// script is no longer in generated.
+func staleUserscriptFolders(generated map[string]*generatedUserscript) []string {
+	var stale []string
+	entries, _ := os.ReadDir(extensionsDir())
+	for _, entry := range entries {
+		folder := entry.Name()
+		if !entry.IsDir() || !strings.HasPrefix(folder, userscriptPrefix) || generated[folder] != nil {
+			continue
+		}
+		if generatedBy(filepath.Join(extensionsDir(), folder), UserscriptSource, userscriptFile) {
+			stale = append(stale, folder)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// userscriptUpToDate reports whether folder already holds exactly g's files.
+func userscriptUpToDate(folder string, g *generatedUserscript) bool {
+	if readMarker(filepath.Join(extensionsDir(), folder)) == nil {
+		return false
+	}
+	for name, data := range g.Files {
+		existing, err := os.ReadFile(filepath.Join(extensionsDir(), folder, name))
+		if err != nil || !bytes.Equal(existing, data) {
+			return false
+		}
+	}
+	return true
+}
+
+// UserscriptsChanged reports whether SyncUserscripts has anything to do. Used by
+// the unelevated launcher to decide whether to invoke the elevated patcher.
+func UserscriptsChanged() bool {
+	generated, _ := generateUserscripts()
+	for folder, g := range generated {
+		if !userscriptUpToDate(folder, g) {
+			return true
+		}
+	}
+	return len(staleUserscriptFolders(generated)) > 0
+}
+
+// SyncUserscripts generates an extension for every userscript that is new or has
+// changed, and removes the extensions of scripts that were deleted.
+func SyncUserscripts() error {
+	generated, problems := generateUserscripts()
+	stale := staleUserscriptFolders(generated)
+	if len(generated) == 0 && len(problems) == 0 && len(stale) == 0 {
+		return nil
+	}
+
+	fmt.Println("Syncing userscripts...")
+	for _, problem := range problems {
+		fmt.Printf("  Warning: %s\n", problem)
+	}
+	for _, folder := range stale {
+		fmt.Printf("  %s: script removed, deleting\n", folder)
+		if err := os.RemoveAll(filepath.Join(extensionsDir(), folder)); err != nil {
+			return err
+		}
+	}
+
+	folders := make([]string, 0, len(generated))
+	for folder := range generated {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+	for _, folder := range folders {
+		g := generated[folder]
+		for _, warning := range g.Warnings {
+			fmt.Printf("  %s: Warning: %s\n", folder, warning)
+		}
+		if userscriptUpToDate(folder, g) {
+			continue
+		}
+		fmt.Printf("  %s: generated from %s\n", folder, g.Script)
+		dir := filepath.Join(extensionsDir(), folder)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		for name, data := range g.Files {
+			if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+				return fmt.Errorf("writing %s: %v", filepath.Join(folder, name), err)
+			}
+		}
+		if err := writeMarker(dir, Marker{Source: UserscriptSource + g.Script}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UserscriptsReloadPath returns the file WatchUserscripts rewrites after every sync.
+// Running instances watch it and reload their userscript extensions. It lives next
+// to the launcher, where the wrapper can read it without elevation.
+func UserscriptsReloadPath() string {
+	return utils.ResolvePath("userscripts-reload.json")
+}
+
+// WatchUserscripts syncs the userscripts folder, then keeps it synced until ctx is
+// done, signalling running instances to reload after every change.
+func WatchUserscripts(ctx context.Context) error {
+	dir := UserscriptsDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := SyncUserscripts(); err != nil {
+		return err
+	}
+	fmt.Printf("Watching %s; running instances reload userscripts after each change. Press Ctrl-C to stop.\n", dir)
+
+	last := treeFingerprint(dir)
+	pending := false
+	ticker := time.NewTicker(devInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// As in Dev, wait for a tick without changes before syncing.
+		current := treeFingerprint(dir)
+		if current != last {
+			last, pending = current, true
+			continue
+		}
+		if !pending {
+			continue
+		}
+		pending = false
+
+		if !UserscriptsChanged() {
+			continue
+		}
+		if err := SyncUserscripts(); err != nil {
+			fmt.Printf("  Warning: %v\n", err)
+			continue
+		}
+		data, _ := json.Marshal(map[string]int64{"reload": time.Now().UnixNano()})
+		if err := os.WriteFile(UserscriptsReloadPath(), data, 0644); err != nil {
+			fmt.Printf("  Could not signal the reload: %v\n", err)
+			continue
+		}
+		fmt.Printf("  Synced at %s, reloading\n", time.Now().Format("15:04:05"))
+	}
+}
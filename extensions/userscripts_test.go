@@ -0,0 +1,69 @@
+package extensions
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseUserscript(t *testing.T) {
+	src := `// ==UserScript==
+// @name         Wide chat
+// @version      1.2.0-beta
+// @description  Removes the width limit
+// @match        https://claude.ai/*
+// @match        https://*.claude.ai/*
+// @exclude-match https://claude.ai/settings/*
+// @run-at       document-start
+// @grant        none
+// @grant        GM_addStyle
+// ==/UserScript==
+// @match https://example.com/* (not metadata)
+document.body.style.maxWidth = "none";
+`
+	meta, err := parseUserscript([]byte(src))
+	if err != nil {
+		t.Fatalf("parseUserscript: %v", err)
+	}
+	want := &userscriptMeta{
+		Name:           "Wide chat",
+		Version:        "1.2.0-beta",
+		Description:    "Removes the width limit",
+		RunAt:          "document-start",
+		Matches:        []string{"https://claude.ai/*", "https://*.claude.ai/*"},
+		ExcludeMatches: []string{"https://claude.ai/settings/*"},
+		Ignored:        []string{"@grant GM_addStyle"},
+	}
+	if !reflect.DeepEqual(meta, want) {
+		t.Errorf("parseUserscript = %+v, want %+v", meta, want)
+	}
+
+	data, err := userscriptManifest("wide.user.js", meta)
+	if err != nil {
+		t.Fatalf("userscriptManifest: %v", err)
+	}
+	var manifest struct {
+		Version        string `json:"version"`
+		ContentScripts []struct {
+			JS    []string `json:"js"`
+			RunAt string   `json:"run_at"`
+		} `json:"content_scripts"`
+	}
+	json.Unmarshal(data, &manifest)
+	if manifest.Version != "1.2.0" {
+		t.Errorf("manifest version = %q, want 1.2.0", manifest.Version)
+	}
+	if cs := manifest.ContentScripts; len(cs) != 1 || cs[0].RunAt != "document_start" || !reflect.DeepEqual(cs[0].JS, []string{userscriptFile}) {
+		t.Errorf("content_scripts = %+v", cs)
+	}
+
+	for _, bad := range []string{
+		"console.log(1);",
+		"// ==UserScript==\n// @name x\n// ==/UserScript==\n",
+		"// ==UserScript==\n// @match https://claude.ai/*\n",
+	} {
+		if _, err := parseUserscript([]byte(bad)); err == nil {
+			t.Errorf("parseUserscript(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package extensions
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Release assets that publish a checksum or signature for the chosen asset.
+var (
+	checksumListNames = []string{"checksums.txt", "SHA256SUMS", "sha256sums.txt"}
+	signatureSuffixes = []string{".minisig", ".sig"}
+)
+
+// attachVerification records the checksum and signature assets published next to
+// the chosen asset, given every asset name and its download URL.
+func (r *Release) attachVerification(assets map[string]string) {
+	if u, ok := assets[r.AssetName+".sha256"]; ok {
+		r.ChecksumURL = u
+	} else {
+		for _, list := range checksumListNames {
+			for name, u := range assets {
+				if r.ChecksumURL == "" && strings.EqualFold(name, list) {
+					r.ChecksumURL, r.ChecksumList = u, true
+				}
+			}
+		}
+	}
+	for _, suffix := range signatureSuffixes {
+		if u, ok := assets[r.AssetName+suffix]; ok {
+			r.SignatureURL = u
+			break
+		}
+	}
+}
+
+// verifyArtifact checks a downloaded artifact against what its release publishes:
+// the SHA-256 from a .sha256 asset or checksums list, and, when the extension has a
+// public_key, a minisign or raw ed25519 signature, which is then mandatory. A release
+// pinned by extensions.lock is checked against its locked hash (by installRelease)
+// instead of the published checksum, but its signature is still required.
+func verifyArtifact(ctx context.Context, release *Release, ext Extension, path string) error {
+	switch {
+	case release.SHA256 != "":
+		// Checked against the artifact by installRelease.
+	case release.ChecksumURL != "":
+		data, err := getBody(ctx, release.ChecksumURL)
+		if err != nil {
+			return fmt.Errorf("fetching checksum: %v", err)
+		}
+		want, err := parseChecksum(data, release.AssetName, release.ChecksumList)
+		if err != nil {
+			return err
+		}
+		if err := verifySHA256(path, want); err != nil {
+			return err
+		}
+		fmt.Printf("  %s: checksum verified\n", ext.Folder)
+	case ext.PublicKey == "":
+		fmt.Printf("  %s: no checksum published, skipping verification\n", ext.Folder)
+	}
+
+	if ext.PublicKey == "" {
+		return nil
+	}
+	if release.SignatureURL == "" {
+		if release.SHA256 != "" {
+			return fmt.Errorf("a public_key is configured but %s records no signature for this release; run \"ext lock\" again", LockPath())
+		}
+		return fmt.Errorf("a public_key is configured but the release has no %s signature", strings.Join(signatureSuffixes, " or "))
+	}
+	sig, err := getBody(ctx, release.SignatureURL)
+	if err != nil {
+		return fmt.Errorf("fetching signature: %v", err)
+	}
+	if err := verifySignature(path, sig, ext.PublicKey); err != nil {
+		return err
+	}
+	fmt.Printf("  %s: signature verified\n", ext.Folder)
+	return nil
+}
+
+// parseChecksum finds the digest for name in a .sha256 file (just the digest, or
+// "digest  name") or, for lists, in sha256sum output.
+func parseChecksum(data []byte, name string, list bool) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if !list {
+			return fields[0], nil
+		}
+		if len(fields) >= 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no checksum for %s in the release's checksum file", name)
+}
+
+// parsePublicKey accepts a minisign public key (the base64 line, optionally with its
+// "untrusted comment" line) or a base64 raw 32-byte ed25519 key. keyID is nil for
+// raw keys.
+func parsePublicKey(s string) (keyID []byte, pub ed25519.PublicKey, err error) {
+	line := lastDataLine(s)
+	raw, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return nil, nil, fmt.Errorf("public_key is not base64: %v", err)
+	}
+	switch {
+	case len(raw) == 42 && string(raw[:2]) == "Ed":
+		return raw[2:10], ed25519.PublicKey(raw[10:]), nil
+	case len(raw) == ed25519.PublicKeySize:
+		return nil, ed25519.PublicKey(raw), nil
+	}
+	return nil, nil, errors.New("public_key is neither a minisign nor a raw ed25519 key")
+}
+
+// verifySignature checks the file at path against sig, which is either a minisign
+// signature file or a base64 raw ed25519 signature of the file's contents.
+func verifySignature(path string, sig []byte, publicKey string) error {
+	keyID, pub, err := parsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(sig), "\r\n", "\n"), "\n")
+	if !strings.HasPrefix(lines[0], "untrusted comment:") {
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil || len(raw) != ed25519.SignatureSize {
+			return errors.New("signature is neither a minisign file nor a raw ed25519 signature")
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(pub, data, raw) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	}
+	return verifyMinisign(path, lines, keyID, pub)
+}
+
+// verifyMinisign checks a minisign signature: line 2 holds the algorithm ("Ed" signs
+// the file, "ED" its BLAKE2b-512 hash), key ID and signature; line 4 signs that
+// signature together with the trusted comment on line 3.
+func verifyMinisign(path string, lines []string, keyID []byte, pub ed25519.PublicKey) error {
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("malformed minisign signature")
+	}
+	sigLine, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sigLine) != 74 {
+		return errors.New("malformed minisign signature")
+	}
+	alg, sigKeyID, signature := string(sigLine[:2]), sigLine[2:10], sigLine[10:]
+	if keyID != nil && !bytes.Equal(keyID, sigKeyID) {
+		return fmt.Errorf("signed with key %X, but public_key is %X", reverse(sigKeyID), reverse(keyID))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var message []byte
+	switch alg {
+	case "Ed":
+		if message, err = io.ReadAll(f); err != nil {
+			return err
+		}
+	case "ED":
+		h := newBlake2b512()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		message = h.Sum(nil)
+	default:
+		return fmt.Errorf("unsupported minisign algorithm %q", alg)
+	}
+	if !ed25519.Verify(pub, message, signature) {
+		return errors.New("signature verification failed")
+	}
+
+	trusted := strings.TrimPrefix(lines[2], "trusted comment: ")
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || !ed25519.Verify(pub, append(append([]byte(nil), signature...), trusted...), globalSig) {
+		return errors.New("minisign trusted comment signature verification failed")
+	}
+	return nil
+}
+
+// reverse returns b reversed; minisign prints key IDs as little-endian hex.
+func reverse(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
+
+func lastDataLine(s string) string {
+	line := ""
+	for _, l := range strings.Split(s, "\n") {
+		l = strings.TrimSpace(l)
+		if l != "" && !strings.HasPrefix(l, "untrusted comment:") {
+			line = l
+		}
+	}
+	return line
+}
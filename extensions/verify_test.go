@@ -0,0 +1,162 @@
+package extensions
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlake2b512(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"", "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce"},
+		{"abc", "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d17d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923"},
+	} {
+		h := newBlake2b512()
+		h.Write([]byte(tc.in))
+		if got := hex.EncodeToString(h.Sum(nil)); got != tc.want {
+			t.Errorf("BLAKE2b-512(%q) = %s, want %s", tc.in, got, tc.want)
+		}
+	}
+
+	// Block boundaries: the digest must not depend on how the input is split.
+	data := bytes.Repeat([]byte("0123456789abcdef"), 40) // 640 bytes, five full blocks
+	whole := newBlake2b512()
+	whole.Write(data)
+	chunked := newBlake2b512()
+	for i := 0; i < len(data); i += 7 {
+		end := i + 7
+		if end > len(data) {
+			end = len(data)
+		}
+		chunked.Write(data[i:end])
+	}
+	if !bytes.Equal(whole.Sum(nil), chunked.Sum(nil)) {
+		t.Errorf("chunked writes changed the digest")
+	}
+}
+
+// minisign builds a minisign public key and signature for data, prehashed when alg
+// is "ED".
+func minisign(t *testing.T, priv ed25519.PrivateKey, keyID []byte, alg string, data []byte) (string, []byte) {
+	t.Helper()
+	message := data
+	if alg == "ED" {
+		h := newBlake2b512()
+		h.Write(data)
+		message = h.Sum(nil)
+	}
+	sig := ed25519.Sign(priv, message)
+	trusted := "timestamp:1700000000\tfile:ext.zip"
+	global := ed25519.Sign(priv, append(append([]byte(nil), sig...), trusted...))
+
+	pub := append(append([]byte("Ed"), keyID...), priv.Public().(ed25519.PublicKey)...)
+	sigLine := append(append([]byte(alg), keyID...), sig...)
+	pubKey := "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(pub) + "\n"
+	sigFile := "untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(sigLine) + "\n" +
+		"trusted comment: " + trusted + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n"
+	return pubKey, []byte(sigFile)
+}
+
+func TestVerifySignature(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	data := []byte("extension archive contents")
+	path := filepath.Join(t.TempDir(), "ext.zip")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, alg := range []string{"Ed", "ED"} {
+		pubKey, sig := minisign(t, priv, keyID, alg, data)
+		if err := verifySignature(path, sig, pubKey); err != nil {
+			t.Errorf("%s: valid signature rejected: %v", alg, err)
+		}
+
+		otherKey, _ := minisign(t, priv, []byte{8, 7, 6, 5, 4, 3, 2, 1}, alg, data)
+		if err := verifySignature(path, sig, otherKey); err == nil {
+			t.Errorf("%s: signature accepted for a different key ID", alg)
+		}
+
+		tamperedComment := bytes.Replace(sig, []byte("file:ext.zip"), []byte("file:evil.zip"), 1)
+		if err := verifySignature(path, tamperedComment, pubKey); err == nil {
+			t.Errorf("%s: tampered trusted comment accepted", alg)
+		}
+
+		_, forOther := minisign(t, priv, keyID, alg, []byte("other contents"))
+		if err := verifySignature(path, forOther, pubKey); err == nil {
+			t.Errorf("%s: signature of other contents accepted", alg)
+		}
+	}
+
+	// Raw ed25519 key and signature, both base64.
+	rawKey := base64.StdEncoding.EncodeToString(priv.Public().(ed25519.PublicKey))
+	rawSig := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data)))
+	if err := verifySignature(path, rawSig, rawKey); err != nil {
+		t.Errorf("raw: valid signature rejected: %v", err)
+	}
+	os.WriteFile(path, append(data, '!'), 0644)
+	if err := verifySignature(path, rawSig, rawKey); err == nil {
+		t.Errorf("raw: signature of modified file accepted")
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	list := []byte("aaaa  other.zip\nbbbb *ext-electron.zip\n")
+	if got, err := parseChecksum(list, "ext-electron.zip", true); err != nil || got != "bbbb" {
+		t.Errorf("checksum list: %q, %v", got, err)
+	}
+	if _, err := parseChecksum(list, "missing.zip", true); err == nil {
+		t.Errorf("missing entry found in checksum list")
+	}
+	if got, err := parseChecksum([]byte("cccc  ext-electron.zip\n"), "ext-electron.zip", false); err != nil || got != "cccc" {
+		t.Errorf(".sha256 file: %q, %v", got, err)
+	}
+}
+
+func TestVerifyArtifactLockedNeedsSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("extension archive contents")
+	path := filepath.Join(t.TempDir(), "ext.zip")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(sig))
+	}))
+	defer srv.Close()
+
+	sum, err := fileSHA256(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ext := Extension{Folder: "x", PublicKey: base64.StdEncoding.EncodeToString(pub)}
+	ctx := context.Background()
+
+	if err := verifyArtifact(ctx, &Release{SHA256: sum}, ext, path); err == nil {
+		t.Error("locked release without a signature accepted")
+	}
+	if err := verifyArtifact(ctx, &Release{SHA256: sum, SignatureURL: srv.URL}, ext, path); err != nil {
+		t.Errorf("locked release with a valid signature rejected: %v", err)
+	}
+	os.WriteFile(path, append(data, '!'), 0644)
+	if err := verifyArtifact(ctx, &Release{SHA256: sum, SignatureURL: srv.URL}, ext, path); err == nil {
+		t.Error("locked release with a bad signature accepted")
+	}
+}
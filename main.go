@@ -1,13 +1,18 @@
 package main
 
 import (
+	"claude-webext-patcher/config"
+	"claude-webext-patcher/extensions"
 	"claude-webext-patcher/patcher"
 	"claude-webext-patcher/selfupdate"
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 )
 
 var launchClaudeInTerminal = false
@@ -16,13 +21,36 @@ var launchClaudeInTerminal = false
 const Version = "3.2.1"
 
 func main() {
+	cfg := config.Load()
+	extensions.Locked = cfg.LockedExtensions
+	extensions.Beta = cfg.Beta
+	selfupdate.Beta = cfg.Beta
+
+	// Ctrl-C / SIGTERM cancel in-flight downloads and patching; each stage cleans up
+	// its temp files and rolls the install back before returning.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Extension management subcommands: "ext list", "ext add", ...
+	if len(os.Args) > 1 && os.Args[1] == "ext" {
+		code := runExtCommand(ctx, os.Args[2:])
+		stop()
+		os.Exit(code)
+	}
+
 	// Parse command-line flags
 	forceUpdate := flag.Bool("force-update", false, "Force update to the latest version even if it's not verified compatible")
-	instanceName := flag.String("instance", "modified", "Instance name for separate data directory and lock")
+	instanceName := flag.String("instance", cfg.DefaultInstance, "Instance name for separate data directory and lock")
 	patcherMode := flag.Bool("patcher", false, "Run in elevated patcher mode (internal)")
 	debug := flag.Bool("debug", false, "Keep console windows open and launch Claude attached to terminal")
+	theme := flag.String("theme", "", "Theme for this instance: a .css file in the themes folder, or \"none\" (default: from config.json)")
 	flag.Parse()
 
+	themeName := cfg.Theme(*instanceName)
+	if *theme != "" {
+		themeName = *theme
+	}
+
 	launchClaudeInTerminal = *debug
 
 	fmt.Printf("Claude_WebExtension_Launcher version: %s\n", Version)
@@ -35,7 +63,7 @@ func main() {
 
 	// Patcher mode: do admin work and exit (Windows only)
 	if *patcherMode {
-		os.Exit(runPatcherMode(*forceUpdate, *debug))
+		os.Exit(runPatcherMode(ctx, *debug, *instanceName, themeName))
 	}
 
 	// Handle update completion first
@@ -50,16 +78,22 @@ func main() {
 	fmt.Println("Claude WebExtension Launcher starting...")
 	fmt.Printf("Version: %s\n", Version)
 
+	// Report how the extensions fared when this instance last ran
+	extensions.PrintStatus(*instanceName)
+
 	// Check for self-updates
-	if err := selfupdate.CheckAndUpdate(); err != nil {
+	if err := selfupdate.CheckAndUpdate(ctx); err != nil {
 		fmt.Printf("Update check failed: %v\n", err)
 		// Continue anyway
 	}
+	exitIfCancelled(ctx)
 
 	// Ensure Claude is patched and extensions are up-to-date.
 	// On Windows this may invoke an elevated patcher subprocess via UAC.
 	// On macOS this runs in-process.
-	if err := ensureClaudeReady(*forceUpdate); err != nil {
+	err := ensureClaudeReady(ctx, *forceUpdate, *instanceName, themeName)
+	exitIfCancelled(ctx)
+	if err != nil {
 		if _, statErr := os.Stat(claudeExecutablePath()); statErr == nil {
 			fmt.Printf("Warning: %v\n", err)
 			fmt.Println("Continuing with existing installation...")
@@ -69,18 +103,24 @@ func main() {
 		}
 	}
 
+	// Point out extensions that don't declare support for this Claude version
+	extensions.WarnIncompatible()
+
 	// Release any platform-specific privileges before launching Claude
 	releaseAdminContext()
 
 	// Carry over Cowork sessions from the official app before any uninstall prompt (Windows only)
-	migrateCoworkSessions()
+	migrateCoworkSessions(cfg.DefaultInstance)
 
 	// Check for official Claude MSIX installation (Windows only)
 	checkMSIXAndPrompt(*instanceName)
 
-	// Clear caches that interfere with extension loading and updates
+	// Clear caches that interfere with extension loading and updates, unless
+	// "ext dev" is running and reloads extensions itself
 	claudeDataDir := claudeUserDataDir(*instanceName)
-	if claudeDataDir != "" {
+	if cfg.ClearCache && extensions.DevActive() {
+		fmt.Println("Extension dev mode is on, keeping caches")
+	} else if claudeDataDir != "" && cfg.ClearCache {
 		cacheDirs := []string{"Service Worker", "WebStorage", "Cache", "Code Cache"}
 		fmt.Printf("Clearing cache folders:\n")
 		for _, dir := range cacheDirs {
@@ -95,11 +135,18 @@ func main() {
 	fmt.Println("Launching Claude.")
 	claudePath := claudeExecutablePath()
 	instanceArg := fmt.Sprintf("--instance=%s", *instanceName)
+	env := os.Environ()
+	if instanceEnv, err := extensions.InstanceEnv(*instanceName); err != nil {
+		fmt.Printf("Warning: ignoring the extension set of instance %s: %v\n", *instanceName, err)
+	} else if instanceEnv != "" {
+		env = append(env, instanceEnv)
+	}
 
 	if launchClaudeInTerminal {
 		// In developer mode, run Claude in the same terminal to see debug output
 		cmd := exec.Command(claudePath, instanceArg)
 		cmd.Dir = filepath.Dir(claudePath)
+		cmd.Env = env
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		cmd.Stdin = os.Stdin
@@ -108,6 +155,16 @@ func main() {
 		// Launch detached
 		cmd := exec.Command(claudePath, instanceArg)
 		cmd.Dir = filepath.Dir(claudePath)
+		cmd.Env = env
 		cmd.Start()
 	}
 }
+
+// exitIfCancelled exits once ctx has been cancelled by a signal, so an interrupted
+// update never goes on to launch Claude.
+func exitIfCancelled(ctx context.Context) {
+	if ctx.Err() != nil {
+		fmt.Println("Interrupted, exiting.")
+		os.Exit(130)
+	}
+}
@@ -5,6 +5,7 @@ package main
 import (
 	"claude-webext-patcher/extensions"
 	"claude-webext-patcher/patcher"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -63,25 +64,39 @@ func claudeInstalled() bool {
 }
 
 // ensureClaudeReady runs patching and extension updates in-process on macOS.
-func ensureClaudeReady(forceUpdate bool) error {
-	if err := patcher.EnsurePatched(forceUpdate); err != nil {
+func ensureClaudeReady(ctx context.Context, forceUpdate bool, instance, theme string) error {
+	if err := patcher.EnsurePatched(ctx); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
 		if claudeInstalled() {
 			fmt.Printf("Warning: patching failed (%v), launching existing installation.\n", err)
 		} else {
 			return err
 		}
 	}
-	if err := extensions.UpdateAll(); err != nil {
+	if err := extensions.UpdateAll(ctx); err != nil {
 		fmt.Printf("Warning: extension update failed: %v\n", err)
 	}
+	if err := extensions.SyncUserscripts(); err != nil {
+		fmt.Printf("Warning: userscript sync failed: %v\n", err)
+	}
+	if err := extensions.SyncTheme(instance, theme); err != nil {
+		fmt.Printf("Warning: theme could not be applied: %v\n", err)
+	}
 	if err := patcher.DeploySentinelExtension(); err != nil {
 		fmt.Printf("Warning: sentinel extension deployment failed: %v\n", err)
 	}
 	return nil
 }
 
+// withInstallAccess runs fn directly; the install directory is user-writable here.
+func withInstallAccess(fn func() error) error {
+	return fn()
+}
+
 // runPatcherMode is not used on non-Windows platforms.
-func runPatcherMode(forceUpdate bool, debug bool) int {
+func runPatcherMode(ctx context.Context, debug bool, instance, theme string) int {
 	fmt.Println("--patcher is not supported on this platform")
 	return 1
 }
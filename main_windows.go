@@ -6,10 +6,12 @@ import (
 	"claude-webext-patcher/extensions"
 	"claude-webext-patcher/patcher"
 	"claude-webext-patcher/utils"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 )
 
 // prepareAdminContext cleans up old installation files from the launcher directory.
@@ -42,7 +44,7 @@ func claudeExecutablePath() string {
 
 // runPatcherMode runs the elevated patcher code path. Called when the launcher
 // is re-invoked with --patcher via UAC.
-func runPatcherMode(forceUpdate bool, debug bool) int {
+func runPatcherMode(ctx context.Context, debug bool, instance, theme string) int {
 	fmt.Println("Running in elevated patcher mode...")
 
 	if err := patcher.TakeWindowsAppsOwnership(); err != nil {
@@ -52,21 +54,44 @@ func runPatcherMode(forceUpdate bool, debug bool) int {
 		return 1
 	}
 
-	if err := patcher.EnsurePatched(forceUpdate); err != nil {
+	if err := patcher.EnsurePatched(ctx); err != nil {
 		fmt.Printf("Patching failed: %v\n", err)
 		patcher.ReleaseWindowsAppsOwnership()
+		if ctx.Err() != nil {
+			return 1
+		}
 		fmt.Println("Press Enter to exit...")
 		fmt.Scanln()
 		return 1
 	}
 
-	if err := extensions.UpdateAll(); err != nil {
+	if err := extensions.UpdateAll(ctx); err != nil {
 		fmt.Printf("Warning: extension update failed: %v\n", err)
 		if debug {
 			fmt.Println("Press Enter to continue...")
 			fmt.Scanln()
 		}
 	}
+	if ctx.Err() != nil {
+		patcher.ReleaseWindowsAppsOwnership()
+		return 1
+	}
+
+	if err := extensions.SyncUserscripts(); err != nil {
+		fmt.Printf("Warning: userscript sync failed: %v\n", err)
+		if debug {
+			fmt.Println("Press Enter to continue...")
+			fmt.Scanln()
+		}
+	}
+
+	if err := extensions.SyncTheme(instance, theme); err != nil {
+		fmt.Printf("Warning: theme could not be applied: %v\n", err)
+		if debug {
+			fmt.Println("Press Enter to continue...")
+			fmt.Scanln()
+		}
+	}
 
 	if err := patcher.DeploySentinelExtension(); err != nil {
 		fmt.Printf("Warning: sentinel extension deployment failed: %v\n", err)
@@ -98,8 +123,11 @@ func runPatcherMode(forceUpdate bool, debug bool) int {
 
 // ensureClaudeReady checks whether admin work is needed and, if so, invokes
 // the launcher in elevated patcher mode via UAC.
-func ensureClaudeReady(forceUpdate bool) error {
-	needsAdmin := checkNeedsAdmin(forceUpdate)
+func ensureClaudeReady(ctx context.Context, forceUpdate bool, instance, theme string) error {
+	needsAdmin := checkNeedsAdmin(ctx, forceUpdate, instance, theme)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 
 	if !needsAdmin {
 		fmt.Println("Claude is up to date, no admin work needed.")
@@ -118,6 +146,11 @@ func ensureClaudeReady(forceUpdate bool) error {
 	if launchClaudeInTerminal {
 		args += " --debug"
 	}
+	// The patcher applies this instance's theme, which may come from --theme
+	args += " " + syscall.EscapeArg("--instance="+instance)
+	if theme != "" {
+		args += " " + syscall.EscapeArg("--theme="+theme)
+	}
 
 	fmt.Println("Administrator privileges required for patching...")
 	exitCode, err := utils.RunElevatedAndWait(exe, args)
@@ -142,7 +175,7 @@ func ensureClaudeReady(forceUpdate bool) error {
 }
 
 // checkNeedsAdmin determines whether the elevated patcher needs to run.
-func checkNeedsAdmin(forceUpdate bool) bool {
+func checkNeedsAdmin(ctx context.Context, forceUpdate bool, instance, theme string) bool {
 	if forceUpdate {
 		return true
 	}
@@ -166,12 +199,17 @@ func checkNeedsAdmin(forceUpdate bool) bool {
 	// Check patch version
 	patchVersionFile := filepath.Join(installDir, "patch-version.txt")
 	patchData, err := os.ReadFile(patchVersionFile)
-	if err != nil || strings.TrimSpace(string(patchData)) != patcher.PatchVersion {
+	if err != nil || strings.TrimSpace(string(patchData)) != patcher.PatchFingerprint(currentVersion) {
+		return true
+	}
+
+	// Check if userscripts or the theme changed; local, so before going online
+	if extensions.UserscriptsChanged() || extensions.ThemeChanged(instance, theme) {
 		return true
 	}
 
 	// Check if a newer Claude version is available
-	newestVersion, _, err := patcher.GetLatestVersion()
+	newestVersion, _, err := patcher.GetLatestVersion(ctx)
 	if err != nil {
 		// Can't reach update server — assume current install is fine
 		return false
@@ -181,13 +219,53 @@ func checkNeedsAdmin(forceUpdate bool) bool {
 	}
 
 	// Check if extensions need updating
-	if extensions.NeedsUpdate() {
+	if extensions.NeedsUpdate(ctx) {
 		return true
 	}
 
 	return false
 }
 
+// withInstallAccess runs fn with write access to the install directory in WindowsApps.
+// Unelevated, it re-runs the current command through UAC and waits for it instead.
+func withInstallAccess(fn func() error) error {
+	if !utils.IsAdmin() {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to get executable path: %v", err)
+		}
+		// The elevated process starts in System32, so it is told where relative
+		// paths in the arguments were meant to be resolved.
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %v", err)
+		}
+		args := []string{os.Args[1], "--elevated", "--cwd", cwd}
+		args = append(args, os.Args[2:]...)
+		for i, a := range args {
+			args[i] = syscall.EscapeArg(a)
+		}
+
+		fmt.Println("Administrator privileges required to modify extensions...")
+		exitCode, err := utils.RunElevatedAndWait(exe, strings.Join(args, " "))
+		if err != nil {
+			return fmt.Errorf("elevation failed: %v", err)
+		}
+		if exitCode != 0 {
+			return fmt.Errorf("elevated command exited with code %d", exitCode)
+		}
+		return nil
+	}
+
+	if err := patcher.TakeWindowsAppsOwnership(); err != nil {
+		return fmt.Errorf("failed to take WindowsApps ownership: %v", err)
+	}
+	defer patcher.ReleaseWindowsAppsOwnership()
+	err := fn()
+	patcher.GrantUserReadAccess()
+	return err
+}
+
 // claudeInstalled returns true if claude.exe exists in the install directory.
 func claudeInstalled() bool {
 	_, err := os.Stat(claudeExecutablePath())
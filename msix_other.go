@@ -4,4 +4,4 @@ package main
 
 func checkMSIXAndPrompt(instanceName string) {}
 
-func migrateCoworkSessions() {}
+func migrateCoworkSessions(defaultInstance string) {}
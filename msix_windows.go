@@ -13,18 +13,18 @@ import (
 )
 
 // migrateCoworkSessions copies the official Claude client's Cowork sessions into the
-// default "modified" instance, once. Cowork sessions live in the userData dir under
-// local-agent-mode-sessions; the official app uses %APPDATA%\Claude while the patched
-// app's default instance uses %APPDATA%\Claude-modified (see wrapper.js). This runs
+// default instance (normally "modified"), once. Cowork sessions live in the userData dir
+// under local-agent-mode-sessions; the official app uses %APPDATA%\Claude while the patched
+// app's default instance uses %APPDATA%\Claude-<instance> (see wrapper.js.tmpl). This runs
 // unelevated and before the official-uninstall prompt, so the user's existing sessions
 // carry over to the patched app. It never overwrites sessions that already exist.
-func migrateCoworkSessions() {
+func migrateCoworkSessions(defaultInstance string) {
 	appData := os.Getenv("APPDATA")
 	if appData == "" {
 		return
 	}
 	src := filepath.Join(appData, "Claude", "local-agent-mode-sessions")
-	dst := filepath.Join(appData, "Claude-modified", "local-agent-mode-sessions")
+	dst := filepath.Join(appData, "Claude-"+defaultInstance, "local-agent-mode-sessions")
 
 	if info, err := os.Stat(src); err != nil || !info.IsDir() {
 		return // nothing to migrate
@@ -0,0 +1,137 @@
+package patcher
+
+import (
+	"claude-webext-patcher/utils"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// patchSource is the source of the content patch functions, hashed into the
+// fingerprint because a function value only identifies the function by name.
+//
+//go:embed patches.go
+var patchSource []byte
+
+// userPatchDirName is the launcher-local folder holding user-supplied main-process
+// scripts. Every *.js file in it is copied next to wrapper.js and required by the
+// wrapper before the original app boots.
+const userPatchDirName = "user-patches"
+
+// PatchFingerprint returns the value recorded in patch-version.txt for the given
+// Claude version: PatchVersion plus a hash of everything that ends up in the patched
+// asar — the embedded injection files, the launcher configuration rendered into the
+// wrapper, the patch definitions that apply to version, the source of the content
+// patches (patches.go) and any user patches. Editing any of them changes the
+// fingerprint, so EnsurePatched and checkNeedsAdmin pick up the change without a
+// manual PatchVersion bump.
+func PatchFingerprint(version string) string {
+	h := sha256.New()
+
+	fs.WalkDir(EmbeddedFS, "resources/injections", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if data, err := EmbeddedFS.ReadFile(path); err == nil {
+			hashEntry(h, path, data)
+		}
+		return nil
+	})
+
+	if data, err := json.Marshal(currentWrapperConfig()); err == nil {
+		hashEntry(h, "wrapper-config", data)
+	}
+
+	for i, patch := range patchesFor(version) {
+		def := fmt.Sprintf("files=%s exclude=%s func=%s",
+			strings.Join(patch.Files, ","), strings.Join(patch.Exclude, ","), funcName(patch.Func))
+		hashEntry(h, fmt.Sprintf("patch/%d", i), []byte(def))
+	}
+	hashEntry(h, "patches.go", patchSource)
+
+	for _, path := range userPatchFiles() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		hashEntry(h, "user/"+filepath.Base(path), data)
+	}
+
+	return PatchVersion + "+" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// hashEntry writes a length-prefixed name/content pair so that moving bytes between
+// entries can't produce the same digest.
+func hashEntry(h hash.Hash, name string, data []byte) {
+	fmt.Fprintf(h, "%d:%s:%d:", len(name), name, len(data))
+	h.Write(data)
+}
+
+func funcName(f func([]byte) ([]byte, error)) string {
+	if f == nil {
+		return ""
+	}
+	if fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return ""
+}
+
+// patchesFor returns the content patches for version, falling back to the generic set.
+func patchesFor(version string) []Patch {
+	if patches, ok := supportedVersions[version]; ok && len(patches) > 0 {
+		return patches
+	}
+	return supportedVersions["generic"]
+}
+
+// userPatchFiles lists the *.js files in the user patch folder, sorted by name.
+func userPatchFiles() []string {
+	matches, _ := filepath.Glob(filepath.Join(utils.ResolvePath(userPatchDirName), "*.js"))
+	sort.Strings(matches)
+	return matches
+}
+
+// installUserPatches copies the user patch scripts into .vite/build/user-patches so the
+// wrapper can require them.
+func installUserPatches(r *runner, tempDir string) error {
+	files := userPatchFiles()
+	if len(files) == 0 {
+		return nil
+	}
+
+	dstDir := filepath.Join(tempDir, ".vite", "build", userPatchDirName)
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return err
+	}
+	for _, src := range files {
+		in, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		out, err := os.Create(filepath.Join(dstDir, filepath.Base(src)))
+		if err != nil {
+			in.Close()
+			return err
+		}
+		_, err = io.Copy(out, in)
+		in.Close()
+		out.Close()
+		if err != nil {
+			return err
+		}
+		r.logf("Installed user patch %s", filepath.Base(src))
+	}
+	return nil
+}
@@ -1,8 +1,13 @@
 package patcher
 
 import (
+	"bytes"
 	"claude-webext-patcher/asar"
+	"claude-webext-patcher/config"
+	"claude-webext-patcher/extensions"
+	"claude-webext-patcher/protocol"
 	"claude-webext-patcher/utils"
+	"context"
 	"embed"
 	"encoding/json"
 	"fmt"
@@ -11,6 +16,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"text/template"
 )
 
 // EmbeddedFS is the embedded filesystem from the main package
@@ -50,27 +56,6 @@ type MacOSManifest struct {
 	} `json:"releases"`
 }
 
-type Patch struct {
-	Files   []string
-	Exclude []string
-	Func    func(content []byte) []byte
-}
-
-var supportedVersions = map[string][]Patch{
-	// Generic patch that should work for most versions.
-	// The wrapper (installed separately) handles instance isolation, multi-instance
-	// lock, extension loading, and polyfills. These content patches handle things
-	// that can't be done from the wrapper.
-	"generic": {
-		{
-			Files:   []string{".vite/build/index*.js"},
-			Exclude: []string{"index.pre", "wrapper"},
-			Func:    patchProtocolArray,
-		},
-	},
-	// Add version-specific overrides here when needed
-}
-
 // Cached verified versions list (loaded on first use)
 var versionsVerifiedGenericCompatible []string
 
@@ -92,10 +77,10 @@ func InstallBaseDir() string {
 }
 
 // ForceRedownload deletes the version file and forces a full re-download and re-patch.
-func ForceRedownload() error {
+func ForceRedownload(ctx context.Context) error {
 	claudeVersionFile := filepath.Join(installBaseDir, "claude-version.txt")
 	os.Remove(claudeVersionFile)
-	return EnsurePatched(true)
+	return EnsurePatched(ctx)
 }
 
 // Load verified versions from GitHub, with fallback to embedded JSON
@@ -150,7 +135,7 @@ func IsVersionVerified(version string) bool {
 }
 
 func DeploySentinelExtension() error {
-	sentinelDir := filepath.Join(utils.ResolveInstallPath("web-extensions"), "sentinel")
+	sentinelDir := filepath.Join(utils.ResolveInstallPath("web-extensions"), extensions.SentinelFolder)
 	os.MkdirAll(sentinelDir, 0755)
 
 	for _, name := range []string{"manifest.json", "content.js"} {
@@ -167,44 +152,9 @@ func DeploySentinelExtension() error {
 	return nil
 }
 
-// patchProtocolArray adds "chrome-extension:" to the allowed protocols array.
-// Matches the prefix ["devtools:","file:" and inserts before the closing ].
-func patchProtocolArray(content []byte) []byte {
-	contentStr := string(content)
-
-	prefix := `["devtools:","file:"`
-	idx := strings.Index(contentStr, prefix)
-	if idx == -1 {
-		fmt.Println("Warning: Could not find protocol array prefix in bundle")
-		debugPause()
-		return content
-	}
-
-	// Find the closing ] after the prefix
-	closingIdx := strings.Index(contentStr[idx:], "]")
-	if closingIdx == -1 {
-		fmt.Println("Warning: Could not find closing ] for protocol array")
-		debugPause()
-		return content
-	}
-	closingIdx += idx
-
-	// Check if chrome-extension: is already present
-	arrayContent := contentStr[idx : closingIdx+1]
-	if strings.Contains(arrayContent, "chrome-extension:") {
-		fmt.Println("Protocol array already contains chrome-extension:, skipping")
-		return content
-	}
-
-	// Insert ,"chrome-extension:" before the ]
-	contentStr = contentStr[:closingIdx] + `,"chrome-extension:"` + contentStr[closingIdx:]
-	fmt.Println("Added chrome-extension: to protocol array")
-	return []byte(contentStr)
-}
-
-// installWrapper copies the wrapper.js into the unpacked asar and redirects
+// installWrapper renders wrapper.js into the unpacked asar and redirects
 // package.json to load it instead of the original entry point.
-func installWrapper(tempDir string, version string) error {
+func installWrapper(r *runner, tempDir string, version string) error {
 	// Read and modify package.json
 	pkgPath := filepath.Join(tempDir, "package.json")
 	pkgData, err := os.ReadFile(pkgPath)
@@ -221,7 +171,7 @@ func installWrapper(tempDir string, version string) error {
 	if originalMain == "" {
 		return fmt.Errorf("package.json has no main field")
 	}
-	fmt.Printf("Original main entry: %s\n", originalMain)
+	r.logf("Original main entry: %s", originalMain)
 
 	pkg["main"] = ".vite/build/wrapper.js"
 	pkg["_originalMain"] = originalMain
@@ -233,257 +183,262 @@ func installWrapper(tempDir string, version string) error {
 	if err := os.WriteFile(pkgPath, newPkgData, 0644); err != nil {
 		return fmt.Errorf("writing package.json: %v", err)
 	}
-	fmt.Println("Redirected package.json main to wrapper.js")
+	r.logf("Redirected package.json main to wrapper.js")
 
-	// Try version-specific wrapper first, fall back to generic
-	wrapperPath := "resources/injections/" + version + "/wrapper.js"
-	wrapperData, err := EmbeddedFS.ReadFile(wrapperPath)
+	wrapperData, err := renderWrapper(r, version)
 	if err != nil {
-		wrapperPath = "resources/injections/generic/wrapper.js"
-		wrapperData, err = EmbeddedFS.ReadFile(wrapperPath)
-		if err != nil {
-			return fmt.Errorf("reading embedded wrapper.js: %v", err)
-		}
-		fmt.Println("Using generic wrapper.js")
-	} else {
-		fmt.Printf("Using version-specific wrapper.js for %s\n", version)
+		return err
 	}
 
 	wrapperDst := filepath.Join(tempDir, ".vite", "build", "wrapper.js")
 	if err := os.WriteFile(wrapperDst, wrapperData, 0644); err != nil {
 		return fmt.Errorf("writing wrapper.js: %v", err)
 	}
-	fmt.Println("Installed wrapper.js")
+	r.logf("Installed wrapper.js")
 
 	return nil
 }
 
-func canFallbackToExisting() bool {
-	_, err := os.Stat(appExePath)
-	return err == nil
+// wrapperConfig is the launcher configuration rendered into wrapper.js.tmpl.
+type wrapperConfig struct {
+	DefaultInstance    string            `json:"default_instance"`
+	ExtensionsPath     string            `json:"extensions_path"`
+	RegistryPath       string            `json:"registry_path"`
+	DevControlPath     string            `json:"dev_control_path"`
+	StatusDir          string            `json:"status_dir"`
+	ThemePrefix        string            `json:"theme_prefix"`
+	ThemeSource        string            `json:"theme_source"`
+	UserscriptSource   string            `json:"userscript_source"`
+	UserscriptsReload  string            `json:"userscripts_reload"`
+	MarkerFile         string            `json:"marker_file"`
+	SentinelFolder     string            `json:"sentinel_folder"`
+	InstanceEnvVar     string            `json:"instance_env_var"`
+	SentinelMaxReloads int               `json:"sentinel_max_reloads"`
+	SentinelTimeoutMS  int               `json:"sentinel_timeout_ms"`
+	ClearCache         bool              `json:"clear_cache"`
+	Polyfills          config.Polyfills  `json:"polyfills"`
+	Protocol           protocol.Messages `json:"protocol"`
 }
 
-func EnsurePatched(forceUpdate bool) error {
-	if err := prepareInstallDir(); err != nil {
-		return fmt.Errorf("setting up install directory: %v", err)
+func currentWrapperConfig() wrapperConfig {
+	cfg := config.Load()
+	return wrapperConfig{
+		DefaultInstance:    cfg.DefaultInstance,
+		ExtensionsPath:     utils.ResolveInstallPath("web-extensions"),
+		RegistryPath:       extensions.RegistryPath(),
+		DevControlPath:     extensions.DevControlPath(),
+		StatusDir:          extensions.StatusDir(),
+		ThemePrefix:        extensions.ThemeFolderPrefix,
+		ThemeSource:        extensions.ThemeSource,
+		UserscriptSource:   extensions.UserscriptSource,
+		UserscriptsReload:  extensions.UserscriptsReloadPath(),
+		MarkerFile:         extensions.MarkerFile,
+		SentinelFolder:     extensions.SentinelFolder,
+		InstanceEnvVar:     extensions.InstanceEnvVar,
+		SentinelMaxReloads: cfg.SentinelMaxReloads,
+		SentinelTimeoutMS:  cfg.SentinelTimeoutMS,
+		ClearCache:         cfg.ClearCache,
+		Polyfills:          cfg.Polyfills,
+		Protocol:           protocol.Current(),
 	}
+}
 
-	// Get current version (stored at installBaseDir level, not inside AppFolder)
-	currentVersion := ""
-	claudeVersionFile := filepath.Join(installBaseDir, "claude-version.txt")
-	if data, err := os.ReadFile(claudeVersionFile); err == nil {
-		currentVersion = strings.TrimSpace(string(data))
-		fmt.Printf("Current version: %s\n", currentVersion)
-	}
+var wrapperFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
 
-	// Get latest version and download URL
-	newestVersion, downloadURL, err := GetLatestVersion()
+// renderWrapper renders wrapper.js from the version-specific template if there is
+// one, otherwise from the generic template.
+func renderWrapper(r *runner, version string) ([]byte, error) {
+	tmplPath := "resources/injections/" + version + "/wrapper.js.tmpl"
+	tmplData, err := EmbeddedFS.ReadFile(tmplPath)
 	if err != nil {
-		// If we have an existing installation, continue using it
-		if currentVersion != "" {
-			fmt.Printf("Warning: %v\n", err)
-			fmt.Printf("Continuing with existing installation (version %s)\n", currentVersion)
-			debugPause()
-
-			// Check if the app executable exists
-			if _, err := os.Stat(appExePath); os.IsNotExist(err) {
-				return fmt.Errorf("existing installation is incomplete (executable not found)")
-			}
-
-			return nil // Continue with existing installation
+		tmplPath = "resources/injections/generic/wrapper.js.tmpl"
+		tmplData, err = EmbeddedFS.ReadFile(tmplPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading embedded wrapper.js.tmpl: %v", err)
 		}
-		// No existing installation and no version available
-		return fmt.Errorf("no versions available and no existing installation found")
+		r.logf("Using generic wrapper.js")
+	} else {
+		r.logf("Using version-specific wrapper.js for %s", version)
 	}
 
-	fmt.Printf("Latest version: %s\n", newestVersion)
+	tmpl, err := template.New("wrapper.js").Funcs(wrapperFuncs).Option("missingkey=error").Parse(string(tmplData))
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", tmplPath, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, currentWrapperConfig()); err != nil {
+		return nil, fmt.Errorf("rendering %s: %v", tmplPath, err)
+	}
+	return buf.Bytes(), nil
+}
 
-	// Always update to the latest version
-	shouldUpdate := currentVersion != newestVersion
-	if shouldUpdate {
-		if !IsVersionVerified(newestVersion) {
-			fmt.Printf("Note: Version %s has not been explicitly verified, but should work fine.\n", newestVersion)
-			fmt.Println("If you run into issues, let me know on GitHub.")
-		}
+func canFallbackToExisting() bool {
+	_, err := os.Stat(appExePath)
+	return err == nil
+}
+
+// EnsurePatched runs the patch pipeline with console output.
+func EnsurePatched(ctx context.Context) error {
+	_, err := Run(ctx, Options{OnEvent: PrintEvent})
+	return err
+}
+
+func applyPatches(r *runner, version string) error {
+	// Try version-specific patches first, fall back to generic
+	patches := patchesFor(version)
+	if len(patches) == 0 {
+		r.logf("No patches available for version %s (and no generic patches found)", version)
+		return nil
+	}
+	if _, ok := supportedVersions[version]; ok {
+		r.logf("Using version-specific patches for %s", version)
+	} else {
+		r.logf("Using generic patches for version %s", version)
 	}
 
-	// Update if needed
-	patchVersionFile := filepath.Join(installBaseDir, "patch-version.txt")
-	if shouldUpdate {
-		fmt.Printf("Updating to %s...\n", newestVersion)
+	r.logf("Applying patches...")
+	if err := replaceIcons(r); err != nil {
+		r.warnf("Could not replace icons: %v", err)
+	}
 
-		if err := downloadAndExtract(newestVersion, downloadURL); err != nil {
-			if canFallbackToExisting() {
-				fmt.Printf("Warning: download/extract failed (%v), continuing with existing installation.\n", err)
-				debugPause()
-				return nil
-			}
-			return err
-		}
+	asarPath := filepath.Join(appResourcesDir, "app.asar")
+	tempDir := utils.ResolvePath("asar-temp")
 
-		// Write version
-		os.WriteFile(claudeVersionFile, []byte(newestVersion), 0644)
+	// Unpack asar
+	err := r.step(StepUnpack, func() error {
+		r.logf("Unpacking asar...")
+		return asar.ExtractContext(r.ctx, asarPath, tempDir)
+	})
+	defer os.RemoveAll(tempDir)
+	if err != nil {
+		return fmt.Errorf("unpacking asar: %v", err)
+	}
+	r.logf("Unpacking successful")
 
-		// Apply patches
-		if err := applyPatches(newestVersion); err != nil {
-			if canFallbackToExisting() {
-				fmt.Printf("Warning: patching failed (%v), continuing with existing installation.\n", err)
-				debugPause()
-				return nil
-			}
-			return fmt.Errorf("applying patches: %v", err)
+	err = r.step(StepPatch, func() error {
+		// Install the wrapper (redirects package.json entry point)
+		if err := installWrapper(r, tempDir, version); err != nil {
+			return fmt.Errorf("installing wrapper: %v", err)
 		}
-		os.WriteFile(patchVersionFile, []byte(PatchVersion), 0644)
-	} else {
-		if currentVersion == newestVersion {
-			fmt.Println("Already on the latest version")
+		if err := installUserPatches(r, tempDir); err != nil {
+			return fmt.Errorf("installing user patches: %v", err)
 		}
 
-		// Check if injection code needs updating
-		currentPatchVersion := ""
-		if data, err := os.ReadFile(patchVersionFile); err == nil {
-			currentPatchVersion = strings.TrimSpace(string(data))
-		}
-		if currentPatchVersion != PatchVersion {
-			fmt.Printf("Patch version changed (%s -> %s), re-downloading and re-patching...\n", currentPatchVersion, PatchVersion)
-			if err := downloadAndExtract(newestVersion, downloadURL); err != nil {
-				if canFallbackToExisting() {
-					fmt.Printf("Warning: re-download failed (%v), continuing with existing installation.\n", err)
-					debugPause()
-					return nil
-				}
-				return err
+		// Apply content patches (e.g. protocol array)
+		for i, patch := range patches {
+			r.logf("Applying content patch %d/%d...", i+1, len(patches))
+			pr := applyContentPatch(r, tempDir, patch)
+			pr.Index = i
+			r.result.Patches = append(r.result.Patches, pr)
+			for _, err := range pr.Errors {
+				r.warnf("content patch %d: %v", i+1, err)
 			}
-			if err := applyPatches(newestVersion); err != nil {
-				if canFallbackToExisting() {
-					fmt.Printf("Warning: re-patching failed (%v), continuing with existing installation.\n", err)
-					debugPause()
-					return nil
-				}
-				return fmt.Errorf("applying patches: %v", err)
+			if len(pr.Files) == 0 {
+				r.warnf("content patch %d did not match any files", i+1)
 			}
-			os.WriteFile(claudeVersionFile, []byte(newestVersion), 0644)
-			os.WriteFile(patchVersionFile, []byte(PatchVersion), 0644)
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	return nil
-}
-
-func applyPatches(version string) error {
-	// Try version-specific patches first, fall back to generic
-	patches, ok := supportedVersions[version]
-	if !ok || len(patches) == 0 {
-		patches, ok = supportedVersions["generic"]
-		if !ok || len(patches) == 0 {
-			fmt.Printf("No patches available for version %s (and no generic patches found)\n", version)
-			return nil
+	// Backup original and repack
+	err = r.step(StepRepack, func() error {
+		os.Rename(asarPath, asarPath+".backup")
+		r.logf("Repacking asar...")
+		err := asar.PackWithOptions(r.ctx, tempDir, asarPath, asar.PackOptions{
+			OnProgress: func(done, total int) {
+				r.progress(StepRepack, int64(done), int64(total))
+			},
+		})
+		if err != nil {
+			os.Rename(asarPath+".backup", asarPath)
+			return err
 		}
-		fmt.Printf("Using generic patches for version %s\n", version)
-	} else {
-		fmt.Printf("Using version-specific patches for %s\n", version)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("repacking asar: %v", err)
 	}
+	r.logf("Repacking successful")
 
-	fmt.Println("Applying patches...")
-	if err := replaceIcons(); err != nil {
-		fmt.Printf("Warning: Could not replace icons: %v\n", err)
-		debugPause()
+	if err := r.step(StepFinalize, func() error { return finalizePatches(r) }); err != nil {
+		return err
 	}
 
-	asarPath := filepath.Join(appResourcesDir, "app.asar")
-	tempDir := utils.ResolvePath("asar-temp")
+	r.logf("Patches applied successfully!")
+	return nil
+}
 
-	// Unpack asar
-	fmt.Println("Unpacking asar...")
-	if err := asar.Extract(asarPath, tempDir); err != nil {
-		fmt.Printf("Unpacking failed: %v\n", err)
-		return fmt.Errorf("unpacking asar: %v", err)
-	}
-	fmt.Println("Unpacking successful")
-	defer os.RemoveAll(tempDir)
+// applyContentPatch applies patch to the first of its file patterns that matches
+// anything in tempDir.
+func applyContentPatch(r *runner, tempDir string, patch Patch) PatchResult {
+	var pr PatchResult
+	for _, filePattern := range patch.Files {
+		pattern := filepath.Join(tempDir, filePattern)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			pr.Errors = append(pr.Errors, fmt.Errorf("pattern %s: %v", filePattern, err))
+			continue
+		}
 
-	// Install the wrapper (redirects package.json entry point)
-	if err := installWrapper(tempDir, version); err != nil {
-		return fmt.Errorf("installing wrapper: %v", err)
-	}
+		for _, matchedFile := range matches {
+			baseName := filepath.Base(matchedFile)
+			excluded := false
+			for _, ex := range patch.Exclude {
+				if strings.Contains(baseName, ex) {
+					excluded = true
+					break
+				}
+			}
+			if excluded {
+				continue
+			}
 
-	// Apply content patches (e.g. protocol array)
-	for i, patch := range patches {
-		fmt.Printf("Applying content patch %d/%d...\n", i+1, len(patches))
+			relPath, _ := filepath.Rel(tempDir, matchedFile)
+			relPath = filepath.ToSlash(relPath)
+			r.logf("Patching %s", relPath)
 
-		patchApplied := false
-		for _, filePattern := range patch.Files {
-			pattern := filepath.Join(tempDir, filePattern)
-			matches, err := filepath.Glob(pattern)
+			content, err := os.ReadFile(matchedFile)
 			if err != nil {
-				fmt.Printf("Error with pattern %s: %v\n", filePattern, err)
+				pr.Errors = append(pr.Errors, fmt.Errorf("skipping %s: %v", relPath, err))
 				continue
 			}
 
-			for _, matchedFile := range matches {
-				baseName := filepath.Base(matchedFile)
-				excluded := false
-				for _, ex := range patch.Exclude {
-					if strings.Contains(baseName, ex) {
-						excluded = true
-						break
-					}
-				}
-				if excluded {
-					continue
-				}
-
-				relPath, _ := filepath.Rel(tempDir, matchedFile)
-				fmt.Printf("Patching %s\n", relPath)
-
-				content, err := os.ReadFile(matchedFile)
-				if err != nil {
-					fmt.Printf("  Skipping %s: %v\n", relPath, err)
-					continue
-				}
-
-				newContent := patch.Func(content)
+			newContent, err := patch.Func(content)
+			if err != nil {
+				pr.Errors = append(pr.Errors, fmt.Errorf("%s: %v", relPath, err))
+				continue
+			}
+			if bytes.Equal(newContent, content) {
+				r.logf("  %s already patched, skipping", relPath)
+			} else {
 				if err := os.WriteFile(matchedFile, newContent, 0644); err != nil {
-					fmt.Printf("  Failed to write %s: %v\n", relPath, err)
+					pr.Errors = append(pr.Errors, fmt.Errorf("failed to write %s: %v", relPath, err))
 					continue
 				}
-				patchApplied = true
-			}
-
-			if patchApplied {
-				break
+				pr.Changed = true
 			}
+			pr.Files = append(pr.Files, relPath)
 		}
 
-		if !patchApplied {
-			fmt.Printf("Warning: content patch %d did not match any files\n", i+1)
-			debugPause()
+		if len(pr.Files) > 0 {
+			break
 		}
 	}
-
-	// Backup original and repack
-	os.Rename(asarPath, asarPath+".backup")
-
-	fmt.Println("Repacking asar...")
-	if err := asar.Pack(tempDir, asarPath); err != nil {
-		fmt.Printf("Repacking failed: %v\n", err)
-		os.Rename(asarPath+".backup", asarPath)
-		return fmt.Errorf("repacking asar: %v", err)
-	}
-	fmt.Println("Repacking successful")
-
-	if err := finalizePatches(); err != nil {
-		return err
-	}
-
-	fmt.Println("Patches applied successfully!")
-	return nil
+	return pr
 }
 
-func replaceIcons() error {
-	fmt.Println("Replacing icons...")
+func replaceIcons(r *runner) error {
+	r.logf("Replacing icons...")
 
-	replacePlatformAppIcon()
+	replacePlatformAppIcon(r)
 
 	// Copy other icons (works for all platforms)
 	iconEntries, err := EmbeddedFS.ReadDir("resources/icons")
@@ -500,7 +455,7 @@ func replaceIcons() error {
 		iconPath := "resources/icons/" + entry.Name()
 		dst := filepath.Join(appResourcesDir, entry.Name())
 
-		fmt.Printf("  %s -> %s\n", entry.Name(), dst)
+		r.logf("  %s -> %s", entry.Name(), dst)
 
 		input, err := EmbeddedFS.ReadFile(iconPath)
 		if err != nil {
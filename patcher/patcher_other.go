@@ -3,9 +3,9 @@
 package patcher
 
 import (
-	"archive/zip"
 	"bytes"
 	"claude-webext-patcher/utils"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -34,70 +34,65 @@ func CoworkServiceExists() bool {
 	return true
 }
 
-func finalizePatches() error {
+func finalizePatches(r *runner) error {
 	// Ad-hoc sign on macOS after asar modifications
-	fmt.Println("Signing app with ad-hoc signature...")
 	appPath := filepath.Join(AppFolder, "Claude.app")
-
-	cmd := exec.Command("codesign", "--remove-signature", appPath)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		fmt.Printf("Remove signature output: %s\n", string(output))
-		// Ignore errors, might not be signed
-	} else if len(output) > 0 {
-		fmt.Printf("Remove signature output: %s\n", string(output))
-	}
-
-	cmd = exec.Command("codesign", "--force", "--deep", "--sign", "-", appPath)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		fmt.Printf("Warning: Could not sign app: %v\n%s\n", err, string(output))
-		debugPause()
-	} else {
-		fmt.Printf("App signed successfully\n")
-		if len(output) > 0 {
-			fmt.Printf("Signing output: %s\n", string(output))
-		}
-	}
+	adHocSign(r, appPath)
 
 	// macOS: capture hash mismatch, patch Info.plist, re-sign
-	fmt.Println("Capturing hash mismatch...")
-	expectedHash, actualHash, err := captureHashMismatch()
+	r.logf("Capturing hash mismatch...")
+	expectedHash, actualHash, err := captureHashMismatch(r)
 	if err != nil {
 		return fmt.Errorf("capturing hash: %v", err)
 	}
 
-	fmt.Printf("Expected hash: %s\n", expectedHash)
-	fmt.Printf("Actual hash: %s\n", actualHash)
+	r.logf("Expected hash: %s", expectedHash)
+	r.logf("Actual hash: %s", actualHash)
 
-	fmt.Println("Patching exe...")
+	r.logf("Patching exe...")
 	if err := replaceHashInExe(expectedHash, actualHash); err != nil {
 		return fmt.Errorf("patching exe: %v", err)
 	}
 
 	// Ad-hoc sign on macOS after all modifications
-	fmt.Println("Signing app with ad-hoc signature...")
+	adHocSign(r, appPath)
+
+	return nil
+}
+
+// adHocSign strips the existing signature from the app bundle and re-signs it ad-hoc,
+// as a StepSign so callers see when signing begins and ends. Signing failures are
+// reported as warnings.
+func adHocSign(r *runner, appPath string) {
+	r.step(StepSign, func() error {
+		codesign(r, appPath)
+		return nil
+	})
+}
+
+func codesign(r *runner, appPath string) {
+	r.logf("Signing app with ad-hoc signature...")
 
-	cmd = exec.Command("codesign", "--remove-signature", appPath)
+	cmd := exec.Command("codesign", "--remove-signature", appPath)
 	if output, err := cmd.CombinedOutput(); err != nil {
-		fmt.Printf("Remove signature output: %s\n", string(output))
+		r.logf("Remove signature output: %s", string(output))
+		// Ignore errors, might not be signed
 	} else if len(output) > 0 {
-		fmt.Printf("Remove signature output: %s\n", string(output))
+		r.logf("Remove signature output: %s", string(output))
 	}
 
 	cmd = exec.Command("codesign", "--force", "--deep", "--sign", "-", appPath)
 	if output, err := cmd.CombinedOutput(); err != nil {
-		fmt.Printf("Warning: Could not sign app: %v\n%s\n", err, string(output))
-		debugPause()
+		r.warnf("Could not sign app: %v\n%s", err, string(output))
 	} else {
-		fmt.Printf("App signed successfully\n")
+		r.logf("App signed successfully")
 		if len(output) > 0 {
-			fmt.Printf("Signing output: %s\n", string(output))
+			r.logf("Signing output: %s", string(output))
 		}
 	}
-
-	return nil
 }
 
-func replacePlatformAppIcon() {
+func replacePlatformAppIcon(r *runner) {
 	// Replace the app bundle icon
 	icnsData, err := EmbeddedFS.ReadFile("resources/icons/app.icns")
 	if err == nil {
@@ -105,19 +100,21 @@ func replacePlatformAppIcon() {
 		targetPath := filepath.Join(AppFolder, "Claude.app", "Contents", "Resources", "electron.icns")
 
 		if err := os.WriteFile(targetPath, icnsData, 0644); err != nil {
-			fmt.Printf("Warning: Could not replace app icon: %v\n", err)
+			r.warnf("Could not replace app icon: %v", err)
 		} else {
-			fmt.Println("  Replaced electron.icns")
+			r.logf("  Replaced electron.icns")
 		}
 	}
 }
 
-func GetLatestVersion() (string, string, error) {
-	fmt.Println("Getting latest version for OS: darwin")
-
-	// Parse macOS manifest
-	fmt.Printf("Fetching macOS manifest from: %s\n", macosReleasesURL)
-	resp, err := http.Get(macosReleasesURL)
+// GetLatestVersion resolves the latest Claude version and download URL from the macOS
+// release manifest.
+func GetLatestVersion(ctx context.Context) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", macosReleasesURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return "", "", fmt.Errorf("fetching macOS manifest: %v", err)
 	}
@@ -131,13 +128,12 @@ func GetLatestVersion() (string, string, error) {
 
 	var manifest MacOSManifest
 	if err := json.Unmarshal(body, &manifest); err != nil {
-		// Print first 500 chars for debugging
+		// Include the first 500 chars for debugging
 		debugLen := len(body)
 		if debugLen > 500 {
 			debugLen = 500
 		}
-		fmt.Printf("Failed to parse manifest. First %d chars: %s\n", debugLen, string(body[:debugLen]))
-		return "", "", fmt.Errorf("parsing macOS manifest: %v", err)
+		return "", "", fmt.Errorf("parsing macOS manifest: %v (first %d chars: %s)", err, debugLen, string(body[:debugLen]))
 	}
 
 	// Get the current/latest release
@@ -158,7 +154,9 @@ func GetLatestVersion() (string, string, error) {
 	return "", "", fmt.Errorf("no releases available in macOS manifest")
 }
 
-func downloadAndExtract(version, downloadURL string) error {
+// downloadAndExtract downloads the release zip for version and extracts the app
+// bundle into destDir. The downloaded archive is removed on failure or cancellation.
+func downloadAndExtract(r *runner, version, downloadURL, destDir string) error {
 	newVersionZipName := fmt.Sprintf("Claude-%s.zip", version)
 
 	// Define the download path based on whether we keep files or use temp
@@ -177,108 +175,82 @@ func downloadAndExtract(version, downloadURL string) error {
 	}
 
 	if KeepNupkgFiles && fileExists {
-		fmt.Printf("Using existing file: %s\n", newVersionZipName)
+		r.logf("Using existing file: %s", newVersionZipName)
 	} else {
 		// Download if file doesn't exist or if we're not keeping files
-		fmt.Printf("Downloading from: %s\n", downloadURL)
+		err := r.step(StepDownload, func() error {
+			r.logf("Downloading from: %s", downloadURL)
 
-		resp, err := http.Get(downloadURL)
-		if err != nil {
-			return fmt.Errorf("downloading: %v", err)
-		}
-		defer resp.Body.Close()
+			req, err := http.NewRequestWithContext(r.ctx, "GET", downloadURL, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return fmt.Errorf("downloading: %v", err)
+			}
+			defer resp.Body.Close()
 
-		// Use the already defined download path
-		outFile, err := os.Create(newVersionDownloadPath)
-		if err != nil {
-			return fmt.Errorf("creating file: %v", err)
-		}
-		_, err = io.Copy(outFile, resp.Body)
-		outFile.Close()
+			// Use the already defined download path
+			outFile, err := os.Create(newVersionDownloadPath)
+			if err != nil {
+				return fmt.Errorf("creating file: %v", err)
+			}
+			_, err = r.copyWithProgress(StepDownload, outFile, resp.Body, resp.ContentLength)
+			outFile.Close()
+			if err != nil {
+				os.Remove(newVersionDownloadPath)
+				return fmt.Errorf("saving file: %v", err)
+			}
+			r.logf("Downloaded: %s", newVersionDownloadPath)
+			return nil
+		})
 		if err != nil {
-			return fmt.Errorf("saving file: %v", err)
+			return err
 		}
-		fmt.Printf("Downloaded: %s\n", newVersionDownloadPath)
 	}
 
 	// Extract
-	fmt.Println("Extracting...")
-	os.RemoveAll(AppFolder)
-	os.MkdirAll(AppFolder, 0755)
-
-	zipReader, err := zip.OpenReader(newVersionDownloadPath)
-	if err != nil {
-		return fmt.Errorf("opening archive: %v", err)
-	}
-	// Don't defer close - we need to close before deleting temp file
-
-	for _, f := range zipReader.File {
-		// For macOS, keep the full .app bundle structure
-		relativePath := f.Name
-
-		if relativePath == "" {
-			continue
-		}
-
-		path := filepath.Join(AppFolder, relativePath)
-
-		// Handle PowerShell Compress-Archive's broken directory entries
-		normalizedName := strings.ReplaceAll(f.Name, "\\", "/")
-		isDirectory := f.FileInfo().IsDir() || (f.UncompressedSize64 == 0 && (strings.HasSuffix(normalizedName, "/") || strings.HasSuffix(f.Name, "\\")))
-
-		if isDirectory {
-			os.MkdirAll(path, 0755)
-			continue
+	if err := r.step(StepExtract, func() error { return extractApp(r, newVersionDownloadPath, destDir) }); err != nil {
+		if !KeepNupkgFiles {
+			os.Remove(newVersionDownloadPath)
 		}
+		return err
+	}
 
-		// Skip if path already exists as a directory (created by earlier MkdirAll)
-		if info, err := os.Stat(path); err == nil && info.IsDir() {
-			continue
-		}
-
-		os.MkdirAll(filepath.Dir(path), 0755)
-
-		// Check if this is a symlink on macOS
-		isSymlink := (f.ExternalAttrs>>16)&0170000 == 0120000
+	// Delete the archive file only if KeepNupkgFiles is false
+	if !KeepNupkgFiles {
+		os.Remove(newVersionDownloadPath)
+	} else {
+		r.logf("Keeping archive file: %s", newVersionZipName)
+	}
 
-		if isSymlink {
-			// Read the symlink target
-			src, err := f.Open()
-			if err != nil {
-				continue
-			}
-			linkTarget, err := io.ReadAll(src)
-			src.Close()
-
-			if err == nil && len(linkTarget) > 0 {
-				linkStr := string(linkTarget)
-				// Create the symlink
-				os.Remove(path) // Remove if exists
-				if err := os.Symlink(linkStr, path); err == nil {
-					fmt.Printf("Created symlink: %s -> %s\n", filepath.Base(path), linkStr)
-				} else {
-					fmt.Printf("Failed to create symlink %s: %v\n", path, err)
-				}
-				continue
-			}
-		}
+	return nil
+}
 
-		// Regular file extraction
-		src, _ := f.Open()
-		dst, _ := os.Create(path)
-		io.Copy(dst, src)
-		dst.Close()
-		src.Close()
+// extractApp extracts the macOS release zip into destDir and prepares the bundle:
+// restores symlinks and executable bits and removes the ShipIt updater.
+func extractApp(r *runner, archivePath, destDir string) error {
+	r.logf("Extracting...")
+	os.RemoveAll(destDir)
+	os.MkdirAll(destDir, 0755)
+
+	// Keep the full .app bundle structure, including the framework symlinks
+	err := utils.ExtractZip(r.ctx, archivePath, destDir, utils.ExtractOptions{
+		Symlinks: true,
+		OnProgress: func(done, total int) {
+			r.progress(StepExtract, int64(done), int64(total))
+		},
+	})
+	if err != nil {
+		return err
 	}
 
-	// Close the zip reader before attempting to delete temp file
-	zipReader.Close()
-
 	// macOS specific: Make sure the executable has execute permissions
 	// Make the main executable executable
-	claudeExec := filepath.Join(AppFolder, "Claude.app", "Contents", "MacOS", "Claude")
+	claudeExec := filepath.Join(destDir, "Claude.app", "Contents", "MacOS", "Claude")
 	if err := os.Chmod(claudeExec, 0755); err != nil {
-		fmt.Printf("Warning: Could not set executable permissions: %v\n", err)
+		r.warnf("Could not set executable permissions: %v", err)
 	}
 
 	// Also make helper apps executable
@@ -289,7 +261,7 @@ func downloadAndExtract(version, downloadURL string) error {
 		"Claude Helper (Renderer)",
 	}
 	for _, helper := range helpers {
-		helperPath := filepath.Join(AppFolder, "Claude.app", "Contents", "Frameworks",
+		helperPath := filepath.Join(destDir, "Claude.app", "Contents", "Frameworks",
 			helper+".app", "Contents", "MacOS", helper)
 		if err := os.Chmod(helperPath, 0755); err != nil {
 			// Don't warn for each one, they might not all exist
@@ -298,38 +270,31 @@ func downloadAndExtract(version, downloadURL string) error {
 	}
 
 	// Also make chrome_crashpad_handler executable
-	crashpadPath := filepath.Join(AppFolder, "Claude.app", "Contents", "Frameworks",
+	crashpadPath := filepath.Join(destDir, "Claude.app", "Contents", "Frameworks",
 		"Electron Framework.framework", "Helpers", "chrome_crashpad_handler")
 	if err := os.Chmod(crashpadPath, 0755); err != nil {
 		// Don't warn, might not exist in all versions
 	}
 
 	// Delete ShipIt to prevent self-updates
-	shipItPath := filepath.Join(AppFolder, "Claude.app", "Contents", "Frameworks", "Squirrel.framework", "Resources", "ShipIt")
+	shipItPath := filepath.Join(destDir, "Claude.app", "Contents", "Frameworks", "Squirrel.framework", "Resources", "ShipIt")
 	if err := os.Remove(shipItPath); err != nil && !os.IsNotExist(err) {
-		fmt.Printf("Warning: Could not remove ShipIt: %v\n", err)
-	} else {
-		fmt.Println("Removed ShipIt to prevent self-updates")
-	}
-
-	// Delete the archive file only if KeepNupkgFiles is false
-	if !KeepNupkgFiles {
-		os.Remove(newVersionDownloadPath)
+		r.warnf("Could not remove ShipIt: %v", err)
 	} else {
-		fmt.Printf("Keeping archive file: %s\n", newVersionZipName)
+		r.logf("Removed ShipIt to prevent self-updates")
 	}
 
 	return nil
 }
 
-func captureHashMismatch() (string, string, error) {
+func captureHashMismatch(r *runner) (string, string, error) {
 	cmd := exec.Command(appExePath)
 	output, _ := cmd.CombinedOutput()
 
 	// Parse the error output for the hashes
 	// Looking for pattern: "Integrity check failed for asar archive (EXPECTED vs ACTUAL)"
 	outputStr := string(output)
-	fmt.Println(outputStr)
+	r.logf("%s", outputStr)
 	if strings.Contains(outputStr, "Integrity check failed") {
 		// Extract the hashes using a simple string parse
 		start := strings.Index(outputStr, "(")
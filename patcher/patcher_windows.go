@@ -3,10 +3,9 @@
 package patcher
 
 import (
-	"archive/zip"
 	"claude-webext-patcher/utils"
+	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"os"
@@ -91,7 +90,7 @@ func ensureWindowsAppsFolder() error {
 // deployDLL extracts the embedded version.dll matching the host architecture next to
 // claude.exe. The proxy DLL is loaded by claude.exe via DLL sideloading, so it must match
 // the architecture of the (native) claude.exe we installed — x64 or arm64.
-func deployDLL() error {
+func deployDLL(r *runner) error {
 	arch := HostArch()
 	srcName := fmt.Sprintf("resources/version-%s.dll", arch)
 	dllData, err := EmbeddedFS.ReadFile(srcName)
@@ -111,7 +110,7 @@ func deployDLL() error {
 		return fmt.Errorf("writing version.dll: %v", err)
 	}
 
-	fmt.Printf("Deployed version.dll (%s)\n", arch)
+	r.logf("Deployed version.dll (%s)", arch)
 	return nil
 }
 
@@ -151,9 +150,9 @@ func prepareInstallDir() error {
 	return ensureWindowsAppsFolder()
 }
 
-func finalizePatches() error {
+func finalizePatches(r *runner) error {
 	// On Windows, deploy the proxy DLL (it handles integrity patching at runtime)
-	if err := deployDLL(); err != nil {
+	if err := deployDLL(r); err != nil {
 		return fmt.Errorf("deploying DLL: %v", err)
 	}
 	return nil
@@ -169,17 +168,15 @@ func GrantUserReadAccess() {
 	}
 }
 
-func replacePlatformAppIcon() {
+func replacePlatformAppIcon(r *runner) {
 	// Skip exe icon replacement to preserve code signature
-	fmt.Println("  Skipping exe icon replacement (preserving signature)")
+	r.logf("  Skipping exe icon replacement (preserving signature)")
 }
 
-func GetLatestVersion() (string, string, error) {
+// GetLatestVersion resolves the latest Claude version and MSIX download URL for the
+// native host architecture.
+func GetLatestVersion(ctx context.Context) (string, string, error) {
 	arch := HostArch()
-	fmt.Printf("Getting latest version for OS: windows (%s)\n", arch)
-	if arch == "arm64" {
-		fmt.Println("Detected ARM64 host — installing native arm64 Claude.")
-	}
 	redirectURL := fmt.Sprintf(windowsMSIXRedirectURLFmt, arch)
 
 	// Resolve the MSIX redirect without following it — the 307 response carries the
@@ -189,7 +186,11 @@ func GetLatestVersion() (string, string, error) {
 			return http.ErrUseLastResponse
 		},
 	}
-	resp, err := client.Get(redirectURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", redirectURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return "", "", fmt.Errorf("resolving MSIX redirect: %v", err)
 	}
@@ -209,7 +210,6 @@ func GetLatestVersion() (string, string, error) {
 		return "", "", err
 	}
 
-	fmt.Printf("Selected latest version: %s, URL: %s\n", version, loc)
 	return version, loc, nil
 }
 
@@ -233,7 +233,9 @@ func parseVersionFromMSIXURL(rawURL string) (string, error) {
 	return version, nil
 }
 
-func downloadAndExtract(version, downloadURL string) error {
+// downloadAndExtract downloads the MSIX for version and extracts its app/ payload
+// into destDir. The downloaded archive is removed on failure or cancellation.
+func downloadAndExtract(r *runner, version, downloadURL, destDir string) error {
 	newVersionZipName := fmt.Sprintf("Claude-%s.msix", version)
 
 	// Define the download path based on whether we keep files or use temp
@@ -252,95 +254,74 @@ func downloadAndExtract(version, downloadURL string) error {
 	}
 
 	if KeepNupkgFiles && fileExists {
-		fmt.Printf("Using existing file: %s\n", newVersionZipName)
+		r.logf("Using existing file: %s", newVersionZipName)
 	} else {
 		// Download if file doesn't exist or if we're not keeping files
-		fmt.Printf("Downloading from: %s\n", downloadURL)
-
-		resp, err := http.Get(downloadURL)
-		if err != nil {
-			return fmt.Errorf("downloading: %v", err)
-		}
-		defer resp.Body.Close()
-
-		// Use the already defined download path
-		outFile, err := os.Create(newVersionDownloadPath)
-		if err != nil {
-			return fmt.Errorf("creating file: %v", err)
-		}
-		_, err = io.Copy(outFile, resp.Body)
-		outFile.Close()
+		err := r.step(StepDownload, func() error {
+			r.logf("Downloading from: %s", downloadURL)
+			if HostArch() == "arm64" {
+				r.logf("Detected ARM64 host — installing native arm64 Claude.")
+			}
+
+			req, err := http.NewRequestWithContext(r.ctx, "GET", downloadURL, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return fmt.Errorf("downloading: %v", err)
+			}
+			defer resp.Body.Close()
+
+			// Use the already defined download path
+			outFile, err := os.Create(newVersionDownloadPath)
+			if err != nil {
+				return fmt.Errorf("creating file: %v", err)
+			}
+			_, err = r.copyWithProgress(StepDownload, outFile, resp.Body, resp.ContentLength)
+			outFile.Close()
+			if err != nil {
+				os.Remove(newVersionDownloadPath)
+				return fmt.Errorf("saving file: %v", err)
+			}
+			r.logf("Downloaded: %s", newVersionDownloadPath)
+			return nil
+		})
 		if err != nil {
-			return fmt.Errorf("saving file: %v", err)
+			return err
 		}
-		fmt.Printf("Downloaded: %s\n", newVersionDownloadPath)
 	}
 
 	// Extract
-	fmt.Println("Extracting...")
-	os.RemoveAll(AppFolder)
-	os.MkdirAll(AppFolder, 0755)
-
-	zipReader, err := zip.OpenReader(newVersionDownloadPath)
+	err := r.step(StepExtract, func() error {
+		r.logf("Extracting...")
+		os.RemoveAll(destDir)
+		os.MkdirAll(destDir, 0755)
+
+		// The MSIX wraps the whole app under app/; everything else (AppxManifest.xml,
+		// AppxBlockMap.xml, Assets/, signature, etc.) is skipped. Part names are
+		// OPC-encoded (e.g. "@" -> "%40"), and app.asar's unpacked entries (e.g.
+		// node_modules/@ant/...) reference the decoded form, so decode them.
+		return utils.ExtractZip(r.ctx, newVersionDownloadPath, destDir, utils.ExtractOptions{
+			Prefix:    "app/",
+			DecodeOPC: true,
+			OnProgress: func(done, total int) {
+				r.progress(StepExtract, int64(done), int64(total))
+			},
+		})
+	})
 	if err != nil {
-		return fmt.Errorf("opening archive: %v", err)
-	}
-	// Don't defer close - we need to close before deleting temp file
-
-	for _, f := range zipReader.File {
-		// Windows - the MSIX wraps the whole app under app/; everything else
-		// (AppxManifest.xml, AppxBlockMap.xml, Assets/, signature, etc.) is skipped.
-		if !strings.HasPrefix(f.Name, "app/") {
-			continue
+		if !KeepNupkgFiles {
+			os.Remove(newVersionDownloadPath)
 		}
-		relativePath := strings.TrimPrefix(f.Name, "app/")
-
-		if relativePath == "" {
-			continue
-		}
-
-		// MSIX part names follow OPC, which percent-encodes reserved characters
-		// (e.g. "@" -> "%40"). Decode so files land on disk with their real names —
-		// app.asar's unpacked entries (e.g. node_modules/@ant/...) reference the
-		// decoded form, and the asar repack copies them by that name.
-		if decoded, err := url.PathUnescape(relativePath); err == nil {
-			relativePath = decoded
-		}
-
-		path := filepath.Join(AppFolder, relativePath)
-
-		// Handle PowerShell Compress-Archive's broken directory entries
-		normalizedName := strings.ReplaceAll(f.Name, "\\", "/")
-		isDirectory := f.FileInfo().IsDir() || (f.UncompressedSize64 == 0 && (strings.HasSuffix(normalizedName, "/") || strings.HasSuffix(f.Name, "\\")))
-
-		if isDirectory {
-			os.MkdirAll(path, 0755)
-			continue
-		}
-
-		// Skip if path already exists as a directory (created by earlier MkdirAll)
-		if info, err := os.Stat(path); err == nil && info.IsDir() {
-			continue
-		}
-
-		os.MkdirAll(filepath.Dir(path), 0755)
-
-		// Regular file extraction
-		src, _ := f.Open()
-		dst, _ := os.Create(path)
-		io.Copy(dst, src)
-		dst.Close()
-		src.Close()
+		return err
 	}
 
-	// Close the zip reader before attempting to delete temp file
-	zipReader.Close()
-
 	// Delete the archive file only if KeepNupkgFiles is false
 	if !KeepNupkgFiles {
 		os.Remove(newVersionDownloadPath)
 	} else {
-		fmt.Printf("Keeping archive file: %s\n", newVersionZipName)
+		r.logf("Keeping archive file: %s", newVersionZipName)
 	}
 
 	return nil
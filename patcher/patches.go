@@ -0,0 +1,62 @@
+package patcher
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Content patch functions must be defined in this file: it is embedded as
+// patchSource, so PatchFingerprint changes whenever a patch function's body does.
+
+// Patch is a content patch applied to files inside app.asar. Func returns the patched
+// content, or an error when the file doesn't look the way the patch expects.
+type Patch struct {
+	Files   []string
+	Exclude []string
+	Func    func(content []byte) ([]byte, error)
+}
+
+var supportedVersions = map[string][]Patch{
+	// Generic patch that should work for most versions.
+	// The wrapper (installed separately) handles instance isolation, multi-instance
+	// lock, extension loading, and polyfills. These content patches handle things
+	// that can't be done from the wrapper.
+	"generic": {
+		{
+			Files:   []string{".vite/build/index*.js"},
+			Exclude: []string{"index.pre", "wrapper"},
+			Func:    patchProtocolArray,
+		},
+	},
+	// Add version-specific overrides here when needed
+}
+
+// patchProtocolArray adds "chrome-extension:" to the allowed protocols array.
+// Matches the prefix ["devtools:","file:" and inserts before the closing ].
+// Content that already allows chrome-extension: is returned unchanged.
+func patchProtocolArray(content []byte) ([]byte, error) {
+	contentStr := string(content)
+
+	prefix := `["devtools:","file:"`
+	idx := strings.Index(contentStr, prefix)
+	if idx == -1 {
+		return content, fmt.Errorf("could not find protocol array prefix in bundle")
+	}
+
+	// Find the closing ] after the prefix
+	closingIdx := strings.Index(contentStr[idx:], "]")
+	if closingIdx == -1 {
+		return content, fmt.Errorf("could not find closing ] for protocol array")
+	}
+	closingIdx += idx
+
+	// Check if chrome-extension: is already present
+	arrayContent := contentStr[idx : closingIdx+1]
+	if strings.Contains(arrayContent, "chrome-extension:") {
+		return content, nil
+	}
+
+	// Insert ,"chrome-extension:" before the ]
+	contentStr = contentStr[:closingIdx] + `,"chrome-extension:"` + contentStr[closingIdx:]
+	return []byte(contentStr), nil
+}
@@ -0,0 +1,175 @@
+package patcher
+
+import (
+	"claude-webext-patcher/utils"
+	"os"
+	"path/filepath"
+)
+
+// An update extracts the new Claude into stagingDir and then swaps it with AppFolder,
+// keeping the old installation in previousDir until the update commits. If the update
+// is interrupted (error, Ctrl-C, or a crash) the previous installation is put back.
+func stagingDir() string  { return AppFolder + ".staging" }
+func previousDir() string { return AppFolder + ".previous" }
+
+// rollbackMarker is written into previousDir while an update is uncommitted. Recovery
+// only restores a previousDir that still carries it, so a partially deleted one left
+// by a committed update is never put back.
+const rollbackMarker = ".launcher-rollback"
+
+// installTxn tracks an in-progress update of AppFolder.
+type installTxn struct {
+	r *runner
+	// fresh is set when there was no installation to replace.
+	fresh bool
+	// swapped is set once AppFolder has been moved to previousDir.
+	swapped bool
+	// inPlace is set when AppFolder could not be moved aside and was overwritten
+	// instead; such an update cannot be rolled back.
+	inPlace bool
+	// done is set once the update was committed or rolled back.
+	done bool
+}
+
+func beginInstall(r *runner) *installTxn {
+	os.RemoveAll(stagingDir())
+	return &installTxn{r: r}
+}
+
+// swap moves the extracted staging directory into AppFolder. If AppFolder can't be
+// moved aside (e.g. files held open by a running service on Windows), the staged
+// files are moved over the existing installation instead.
+func (t *installTxn) swap() error {
+	staging := stagingDir()
+	if _, err := os.Stat(AppFolder); os.IsNotExist(err) {
+		t.fresh = true
+		return os.Rename(staging, AppFolder)
+	}
+
+	// The marker is written before the move, so there is no moment at which
+	// previousDir holds the only installation without carrying it.
+	os.RemoveAll(previousDir())
+	marker := filepath.Join(AppFolder, rollbackMarker)
+	if err := writeSynced(marker); err != nil {
+		return err
+	}
+	if err := os.Rename(AppFolder, previousDir()); err != nil {
+		os.Remove(marker)
+		t.r.warnf("could not move the existing installation aside (%v); updating in place without rollback", err)
+		t.inPlace = true
+		os.RemoveAll(AppFolder)
+		err := mergeTree(staging, AppFolder)
+		os.RemoveAll(staging)
+		return err
+	}
+	t.swapped = true
+	return os.Rename(staging, AppFolder)
+}
+
+// writeSynced creates an empty file at path and flushes it to disk.
+func writeSynced(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// commit discards the previous installation.
+func (t *installTxn) commit() {
+	t.done = true
+	os.Remove(filepath.Join(previousDir(), rollbackMarker))
+	os.RemoveAll(previousDir())
+}
+
+// rollback restores the previous installation unless the update already committed
+// or was rolled back.
+func (t *installTxn) rollback() {
+	if t.done {
+		return
+	}
+	t.done = true
+	os.RemoveAll(stagingDir())
+	if t.inPlace {
+		t.r.warnf("the update was applied in place and cannot be rolled back")
+	}
+	if t.fresh {
+		os.RemoveAll(AppFolder)
+	}
+	if t.swapped {
+		t.r.logf("Rolling back to the previous installation...")
+		os.Remove(filepath.Join(previousDir(), rollbackMarker))
+		os.RemoveAll(AppFolder)
+		if err := os.Rename(previousDir(), AppFolder); err != nil {
+			t.r.warnf("could not restore the previous installation: %v", err)
+		}
+	}
+}
+
+// recoverInterruptedInstall repairs what an interrupted run can leave behind: a staging
+// directory, an uncommitted swap, an app.asar that was moved to app.asar.backup but
+// never repacked, and leftover temp files.
+func recoverInterruptedInstall(r *runner) {
+	if _, err := os.Stat(stagingDir()); err == nil {
+		r.logf("Removing incomplete staged update...")
+		os.RemoveAll(stagingDir())
+	}
+
+	// The version files are only written on commit, so an uncommitted previousDir is
+	// the installation they describe. Without AppFolder, previousDir is the only
+	// installation left, whether or not it carries the marker.
+	_, markerErr := os.Stat(filepath.Join(previousDir(), rollbackMarker))
+	_, appErr := os.Stat(AppFolder)
+	_, prevErr := os.Stat(previousDir())
+	if prevErr == nil && (markerErr == nil || os.IsNotExist(appErr)) {
+		r.logf("Restoring the installation from an interrupted update...")
+		os.Remove(filepath.Join(previousDir(), rollbackMarker))
+		os.RemoveAll(AppFolder)
+		if err := os.Rename(previousDir(), AppFolder); err != nil {
+			r.warnf("could not restore the previous installation: %v", err)
+		}
+	} else {
+		os.RemoveAll(previousDir())
+	}
+	// Left in AppFolder if the run stopped between writing it and moving AppFolder.
+	os.Remove(filepath.Join(AppFolder, rollbackMarker))
+
+	asarPath := filepath.Join(appResourcesDir, "app.asar")
+	if _, err := os.Stat(asarPath); os.IsNotExist(err) {
+		if _, err := os.Stat(asarPath + ".backup"); err == nil {
+			r.logf("Restoring app.asar from backup...")
+			os.Rename(asarPath+".backup", asarPath)
+		}
+	}
+
+	os.RemoveAll(utils.ResolvePath("asar-temp"))
+	if matches, _ := filepath.Glob(utils.ResolvePath("Claude-*.tmp")); len(matches) > 0 {
+		for _, m := range matches {
+			os.Remove(m)
+		}
+	}
+}
+
+// mergeTree moves every file under src to the same relative path under dst,
+// creating directories as needed. It stops at the first file it can't move.
+func mergeTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		os.Remove(target)
+		return os.Rename(path, target)
+	})
+}
@@ -0,0 +1,318 @@
+package patcher
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Step identifies a stage of the patch pipeline.
+type Step string
+
+const (
+	StepPrepare  Step = "prepare"  // set up the install directory
+	StepCheck    Step = "check"    // resolve the latest Claude version
+	StepDownload Step = "download" // download the Claude package
+	StepExtract  Step = "extract"  // extract the package into AppFolder
+	StepUnpack   Step = "unpack"   // unpack app.asar
+	StepPatch    Step = "patch"    // install the wrapper and apply content patches
+	StepRepack   Step = "repack"   // repack app.asar
+	StepFinalize Step = "finalize" // deploy the proxy DLL (Windows) or re-sign the app (macOS)
+	StepSign     Step = "sign"     // ad-hoc sign the app bundle (macOS), within finalize
+)
+
+type EventKind int
+
+const (
+	EventLog       EventKind = iota // informational message
+	EventWarning                    // non-fatal problem
+	EventStepStart                  // a Step began
+	EventStepDone                   // a Step finished; Err is set if it failed
+	EventProgress                   // Done/Total progress within a Step
+)
+
+// Event is a progress notification emitted while Run works.
+type Event struct {
+	Kind    EventKind
+	Step    Step
+	Message string
+	// Done and Total are set for EventProgress. Total is -1 when unknown.
+	Done  int64
+	Total int64
+	Err   error
+}
+
+type StepStatus string
+
+const (
+	StepOK     StepStatus = "ok"
+	StepFailed StepStatus = "failed"
+)
+
+// StepResult is the outcome of one pipeline stage.
+type StepResult struct {
+	Step     Step
+	Status   StepStatus
+	Err      error
+	Duration time.Duration
+}
+
+// PatchResult is the outcome of one content patch.
+type PatchResult struct {
+	Index int
+	// Files are the asar-relative paths the patch was applied to.
+	Files []string
+	// Changed reports whether the patch modified at least one file.
+	Changed bool
+	// Errors collects per-file problems (unreadable files, markers not found, ...).
+	Errors []error
+}
+
+// Result describes what Run did.
+type Result struct {
+	PreviousVersion      string
+	PreviousPatchVersion string
+	LatestVersion        string
+	Version              string
+	PatchVersion         string
+	// Updated is true when Claude was downloaded and patched during this run.
+	Updated bool
+	// UsedExisting is true when the update could not be applied and the existing
+	// installation was kept.
+	UsedExisting bool
+	Steps        []StepResult
+	Patches      []PatchResult
+}
+
+// Options controls Run.
+type Options struct {
+	// OnEvent, if set, receives progress events synchronously.
+	OnEvent func(Event)
+}
+
+// runner carries the per-run reporting state through the pipeline.
+type runner struct {
+	ctx     context.Context
+	onEvent func(Event)
+	result  *Result
+}
+
+func (r *runner) emit(e Event) {
+	if r.onEvent != nil {
+		r.onEvent(e)
+	}
+}
+
+func (r *runner) logf(format string, args ...interface{}) {
+	r.emit(Event{Kind: EventLog, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *runner) warnf(format string, args ...interface{}) {
+	r.emit(Event{Kind: EventWarning, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *runner) progress(step Step, done, total int64) {
+	r.emit(Event{Kind: EventProgress, Step: step, Done: done, Total: total})
+}
+
+// step runs fn as the given pipeline stage, recording its outcome.
+func (r *runner) step(s Step, fn func() error) error {
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+	r.emit(Event{Kind: EventStepStart, Step: s})
+	start := time.Now()
+	err := fn()
+	sr := StepResult{Step: s, Status: StepOK, Err: err, Duration: time.Since(start)}
+	if err != nil {
+		sr.Status = StepFailed
+	}
+	r.result.Steps = append(r.result.Steps, sr)
+	r.emit(Event{Kind: EventStepDone, Step: s, Err: err})
+	return err
+}
+
+// progressWriter reports bytes written as EventProgress for a step, at most once per
+// percent (or per MiB when the total is unknown).
+type progressWriter struct {
+	r     *runner
+	step  Step
+	total int64
+	done  int64
+	last  int64
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	if err := w.r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	w.done += int64(len(p))
+	granularity := int64(1 << 20)
+	if w.total > 0 {
+		granularity = w.total / 100
+	}
+	if w.done-w.last >= granularity || w.done == w.total {
+		w.last = w.done
+		w.r.progress(w.step, w.done, w.total)
+	}
+	return len(p), nil
+}
+
+// copyWithProgress copies src to dst, reporting progress for step.
+func (r *runner) copyWithProgress(step Step, dst io.Writer, src io.Reader, total int64) (int64, error) {
+	if total <= 0 {
+		total = -1
+	}
+	return io.Copy(io.MultiWriter(dst, &progressWriter{r: r, step: step, total: total}), src)
+}
+
+// Run brings the Claude installation up to date: it installs the latest version and
+// re-patches whenever the patch fingerprint changed. Progress is reported through
+// opts.OnEvent; the returned Result is populated even when an error is returned.
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	r := &runner{ctx: ctx, onEvent: opts.OnEvent, result: &Result{}}
+	res := r.result
+
+	if err := r.step(StepPrepare, prepareInstallDir); err != nil {
+		return res, fmt.Errorf("setting up install directory: %v", err)
+	}
+	recoverInterruptedInstall(r)
+
+	// Get current version (stored at installBaseDir level, not inside AppFolder)
+	claudeVersionFile := filepath.Join(installBaseDir, "claude-version.txt")
+	if data, err := os.ReadFile(claudeVersionFile); err == nil {
+		res.PreviousVersion = strings.TrimSpace(string(data))
+		r.logf("Current version: %s", res.PreviousVersion)
+	}
+	patchVersionFile := filepath.Join(installBaseDir, "patch-version.txt")
+	if data, err := os.ReadFile(patchVersionFile); err == nil {
+		res.PreviousPatchVersion = strings.TrimSpace(string(data))
+	}
+	res.Version = res.PreviousVersion
+	res.PatchVersion = res.PreviousPatchVersion
+
+	// Get latest version and download URL
+	var newestVersion, downloadURL string
+	err := r.step(StepCheck, func() error {
+		var err error
+		newestVersion, downloadURL, err = GetLatestVersion(ctx)
+		return err
+	})
+	if ctx.Err() != nil {
+		return res, ctx.Err()
+	}
+	if err != nil {
+		// If we have an existing installation, continue using it
+		if res.PreviousVersion != "" {
+			r.warnf("%v", err)
+			r.logf("Continuing with existing installation (version %s)", res.PreviousVersion)
+			if !canFallbackToExisting() {
+				return res, fmt.Errorf("existing installation is incomplete (executable not found)")
+			}
+			res.UsedExisting = true
+			return res, nil
+		}
+		// No existing installation and no version available
+		return res, fmt.Errorf("no versions available and no existing installation found")
+	}
+	res.LatestVersion = newestVersion
+	r.logf("Latest version: %s (%s)", newestVersion, downloadURL)
+
+	// Always update to the latest version, and re-patch when the fingerprint changed
+	patchVersion := PatchFingerprint(newestVersion)
+	switch {
+	case res.PreviousVersion != newestVersion:
+		if !IsVersionVerified(newestVersion) {
+			r.logf("Note: Version %s has not been explicitly verified, but should work fine.", newestVersion)
+			r.logf("If you run into issues, let me know on GitHub.")
+		}
+		r.logf("Updating to %s...", newestVersion)
+	case res.PreviousPatchVersion != patchVersion:
+		r.logf("Patch version changed (%s -> %s), re-downloading and re-patching...", res.PreviousPatchVersion, patchVersion)
+	default:
+		r.logf("Already on the latest version")
+		return res, nil
+	}
+
+	if err := install(r, newestVersion, downloadURL); err != nil {
+		if ctx.Err() != nil {
+			return res, ctx.Err()
+		}
+		if canFallbackToExisting() {
+			r.warnf("update failed (%v), continuing with existing installation.", err)
+			res.UsedExisting = true
+			return res, nil
+		}
+		return res, err
+	}
+
+	// The version files are written last: until they are, the previous installation
+	// (or a re-download on the next run) is authoritative.
+	os.WriteFile(claudeVersionFile, []byte(newestVersion), 0644)
+	os.WriteFile(patchVersionFile, []byte(patchVersion), 0644)
+	res.Version = newestVersion
+	res.PatchVersion = patchVersion
+	res.Updated = true
+
+	return res, nil
+}
+
+// progressLineOpen is set while PrintEvent is redrawing a progress line in place.
+var progressLineOpen bool
+
+// install downloads version into a staging directory, swaps it into AppFolder and
+// patches it. Any failure, including cancellation, rolls AppFolder back to the
+// previous installation.
+func install(r *runner, version, downloadURL string) error {
+	txn := beginInstall(r)
+	defer txn.rollback()
+
+	if err := downloadAndExtract(r, version, downloadURL, stagingDir()); err != nil {
+		return err
+	}
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+	if err := txn.swap(); err != nil {
+		return fmt.Errorf("installing new version: %v", err)
+	}
+	if err := applyPatches(r, version); err != nil {
+		return fmt.Errorf("applying patches: %v", err)
+	}
+	txn.commit()
+	return nil
+}
+
+// PrintEvent writes an event to the console the way the launcher always has, pausing
+// on warnings when Debug is set. It is the OnEvent handler used by EnsurePatched.
+func PrintEvent(e Event) {
+	if e.Kind != EventProgress && progressLineOpen {
+		fmt.Println()
+		progressLineOpen = false
+	}
+	switch e.Kind {
+	case EventLog:
+		fmt.Println(e.Message)
+	case EventWarning:
+		fmt.Printf("Warning: %s\n", e.Message)
+		debugPause()
+	case EventProgress:
+		if e.Step != StepDownload {
+			return
+		}
+		if e.Total > 0 {
+			fmt.Printf("\rDownloading... %d%% (%.1f / %.1f MB)", e.Done*100/e.Total, float64(e.Done)/(1<<20), float64(e.Total)/(1<<20))
+		} else {
+			fmt.Printf("\rDownloading... %.1f MB", float64(e.Done)/(1<<20))
+		}
+		progressLineOpen = true
+	case EventStepDone:
+		if e.Err != nil {
+			fmt.Printf("Step %s failed: %v\n", e.Step, e.Err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Package protocol defines how extensions talk to the wrapper injected into Claude
+// Desktop. Content scripts send commands by logging a prefixed line to the console,
+// which the wrapper reads from the main process; the wrapper answers by dispatching
+// CustomEvents on the page's window. The wrapper template, "ext lint" and the shim
+// "ext adapt" generates are all built from these definitions so they can't drift.
+package protocol
+
+// Console message prefixes, sent by extensions and read by the wrapper.
+const (
+	// LogPrefix marks extension log lines the wrapper echoes to its own log.
+	LogPrefix = "EXT_LOG:"
+	// SentinelMessage, logged with LogPrefix, confirms content scripts are running.
+	SentinelMessage = "SENTINEL_EXT_LOADED"
+	// AlarmPrefix is followed by JSON {action: "create"|"clear", name,
+	// periodInMinutes, when, delayInMinutes}.
+	AlarmPrefix = "CUT_ALARM:"
+	// NotificationPrefix is followed by JSON {title, message}.
+	NotificationPrefix = "CUT_NOTIFICATION:"
+)
+
+// Events the wrapper dispatches on the page's window.
+const (
+	// AlarmFiredEvent carries {name} in its detail.
+	AlarmFiredEvent = "electronAlarmFired"
+	// TabActivatedEvent is fired when the window gains focus or is restored, with
+	// {tabId, windowId} in its detail.
+	TabActivatedEvent = "electronTabActivated"
+	// TabDeactivatedEvent is fired when the window loses focus.
+	TabDeactivatedEvent = "electronTabDeactivated"
+	// TabRemovedEvent is fired when the window is minimized, with
+	// {tabId, removeInfo} in its detail.
+	TabRemovedEvent = "electronTabRemoved"
+)
+
+// Polyfills lists, per chrome.* namespace, the members the wrapper emulates.
+var Polyfills = map[string][]string{
+	"alarms":        {"create", "clear", "onAlarm"},
+	"notifications": {"create"},
+	"tabs":          {"onActivated", "onRemoved"},
+}
+
+// Messages carries the constants above into templates.
+type Messages struct {
+	LogPrefix           string `json:"log_prefix"`
+	SentinelMessage     string `json:"sentinel_message"`
+	AlarmPrefix         string `json:"alarm_prefix"`
+	NotificationPrefix  string `json:"notification_prefix"`
+	AlarmFiredEvent     string `json:"alarm_fired_event"`
+	TabActivatedEvent   string `json:"tab_activated_event"`
+	TabDeactivatedEvent string `json:"tab_deactivated_event"`
+	TabRemovedEvent     string `json:"tab_removed_event"`
+}
+
+// Current returns the protocol this launcher speaks.
+func Current() Messages {
+	return Messages{
+		LogPrefix:           LogPrefix,
+		SentinelMessage:     SentinelMessage,
+		AlarmPrefix:         AlarmPrefix,
+		NotificationPrefix:  NotificationPrefix,
+		AlarmFiredEvent:     AlarmFiredEvent,
+		TabActivatedEvent:   TabActivatedEvent,
+		TabDeactivatedEvent: TabDeactivatedEvent,
+		TabRemovedEvent:     TabRemovedEvent,
+	}
+}
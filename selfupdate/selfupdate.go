@@ -1,21 +1,38 @@
 package selfupdate
 
 import (
-	"archive/zip"
+	"claude-webext-patcher/semver"
 	"claude-webext-patcher/utils"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
 )
 
 // CurrentVersion is set by the main package to the embedded version string.
 var CurrentVersion string
 
+// Beta is set by the main package to also offer prerelease launcher versions.
+var Beta bool
+
+const releasesAPI = "https://api.github.com/repos/lugia19/Claude-WebExtension-Launcher/releases"
+
+// githubRelease is a release as the GitHub API describes it.
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Draft   bool   `json:"draft"`
+	Assets  []struct {
+		Name        string `json:"name"`
+		DownloadURL string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// maxUpdateSize caps how much a launcher release archive may extract to.
+const maxUpdateSize = 512 << 20
+
 type releaseAsset struct {
 	Name        string
 	DownloadURL string
@@ -27,29 +44,16 @@ func FinishUpdateIfNeeded() {
 	finishUpdateIfNeeded(exePath)
 }
 
-func CheckAndUpdate() error {
+// CheckAndUpdate installs a newer launcher release if one is available. Cancelling
+// ctx aborts the download or extraction and removes the temporary files.
+func CheckAndUpdate(ctx context.Context) (err error) {
 	fmt.Println("Checking for installer updates...")
 
 	currentVer := CurrentVersion
 
-	// Check latest release
-	url := "https://api.github.com/repos/lugia19/Claude-WebExtension-Launcher/releases/latest"
-	resp, err := http.Get(url)
+	release, err := latestRelease(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to check for updates: %v", err)
-	}
-	defer resp.Body.Close()
-
-	var release struct {
-		TagName string `json:"tag_name"`
-		Assets  []struct {
-			Name        string `json:"name"`
-			DownloadURL string `json:"browser_download_url"`
-		} `json:"assets"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		return fmt.Errorf("failed to parse release info: %v", err)
+		return err
 	}
 
 	// Strip 'v' prefix if present
@@ -60,7 +64,7 @@ func CheckAndUpdate() error {
 		return fmt.Errorf("failed to get latest version from GitHub")
 	}
 
-	if compareVersions(currentVer, latestVersion) >= 0 {
+	if semver.Compare(currentVer, latestVersion) >= 0 {
 		fmt.Println("Installer is up to date")
 		return nil
 	}
@@ -83,12 +87,25 @@ func CheckAndUpdate() error {
 		}
 		return err
 	}
-	_ = assetName
 
 	// Download to temp
 	fmt.Println("Downloading update...")
 	tempZip := utils.ResolvePath("update-temp.zip")
-	resp, err = http.Get(downloadURL)
+	tempDir := utils.ResolvePath("update-temp")
+	defer func() {
+		// installUpdate cleans up after itself; anything else that fails (including
+		// cancellation) leaves the temp files for us.
+		if err != nil {
+			os.Remove(tempZip)
+			os.RemoveAll(tempDir)
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to download update: %v", err)
 	}
@@ -101,93 +118,74 @@ func CheckAndUpdate() error {
 	_, err = io.Copy(out, resp.Body)
 	out.Close()
 	if err != nil {
-		os.Remove(tempZip)
 		return fmt.Errorf("failed to save update: %v", err)
 	}
 
+	// The zip is run (on Windows, elevated) once installed, so it must match the
+	// release's signed checksums.
+	fmt.Println("Verifying update...")
+	if err := verifyUpdate(ctx, assets, assetName, tempZip); err != nil {
+		return fmt.Errorf("update verification failed, not installing %s: %v", latestVersion, err)
+	}
+
 	// Extract to temp dir
 	fmt.Println("Extracting update...")
-	tempDir := utils.ResolvePath("update-temp")
 	os.RemoveAll(tempDir)
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		os.Remove(tempZip)
 		return fmt.Errorf("failed to create temp dir: %v", err)
 	}
 
-	// Extract zip
-	zipReader, err := zip.OpenReader(tempZip)
-	if err != nil {
-		os.Remove(tempZip)
-		os.RemoveAll(tempDir)
-		return fmt.Errorf("failed to open zip: %v", err)
+	if err := utils.ExtractZip(ctx, tempZip, tempDir, utils.ExtractOptions{MaxSize: maxUpdateSize}); err != nil {
+		return fmt.Errorf("failed to extract update: %v", err)
 	}
 
-	for _, f := range zipReader.File {
-		// Normalize path separators - replace backslashes with forward slashes
-		normalizedName := strings.ReplaceAll(f.Name, "\\", "/")
-		// Then use filepath.Join which will use the correct separator for the OS
-		path := filepath.Join(tempDir, filepath.FromSlash(normalizedName))
-
-		// Treat as directory if IsDir() returns true OR if it's a zero-byte entry ending with slash/backslash
-		isDirectory := f.FileInfo().IsDir() || (f.UncompressedSize64 == 0 && (strings.HasSuffix(normalizedName, "/") || strings.HasSuffix(f.Name, "\\")))
-
-		if isDirectory {
-			fmt.Printf("Creating directory: %s\n", path)
-			os.MkdirAll(path, 0755)
-			continue
-		}
-
-		// Skip if path already exists as a directory (created by earlier MkdirAll)
-		if info, err := os.Stat(path); err == nil && info.IsDir() {
-			fmt.Printf("Skipping %s - already exists as directory\n", path)
-			continue
-		}
-
-		os.MkdirAll(filepath.Dir(path), 0755)
-
-		src, _ := f.Open()
-		dst, _ := os.Create(path)
-		io.Copy(dst, src)
-		dst.Close()
-		src.Close()
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	zipReader.Close()
-
 	fmt.Println("Installing update...")
 	return installUpdate(tempDir, tempZip)
 }
 
-func compareVersions(v1, v2 string) int {
-	// Remove 'v' prefix if present
-	v1 = strings.TrimPrefix(v1, "v")
-	v2 = strings.TrimPrefix(v2, "v")
-
-	parts1 := strings.Split(v1, ".")
-	parts2 := strings.Split(v2, ".")
-
-	// Pad shorter version with zeros
-	maxLen := len(parts1)
-	if len(parts2) > maxLen {
-		maxLen = len(parts2)
+// latestRelease returns the release GitHub marks as latest or, in the beta channel,
+// the newest non-draft release by version, prereleases included.
+func latestRelease(ctx context.Context) (*githubRelease, error) {
+	url := releasesAPI + "/latest"
+	if Beta {
+		url = releasesAPI + "?per_page=30"
 	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for updates: %v", err)
+	}
+	defer resp.Body.Close()
 
-	for i := 0; i < maxLen; i++ {
-		var n1, n2 int
-
-		if i < len(parts1) {
-			n1, _ = strconv.Atoi(parts1[i])
-		}
-		if i < len(parts2) {
-			n2, _ = strconv.Atoi(parts2[i])
+	if !Beta {
+		var release githubRelease
+		if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+			return nil, fmt.Errorf("failed to parse release info: %v", err)
 		}
+		return &release, nil
+	}
 
-		if n1 > n2 {
-			return 1
+	var releases []githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, fmt.Errorf("failed to parse release info: %v", err)
+	}
+	var newest *githubRelease
+	for i, release := range releases {
+		if release.Draft {
+			continue
 		}
-		if n1 < n2 {
-			return -1
+		if newest == nil || semver.Compare(release.TagName, newest.TagName) > 0 {
+			newest = &releases[i]
 		}
 	}
-
-	return 0
+	if newest == nil {
+		return nil, fmt.Errorf("no releases published")
+	}
+	return newest, nil
 }
@@ -0,0 +1,150 @@
+package selfupdate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Launcher releases publish checksums.txt, the sha256sum of every zip, and
+// checksums.txt.sig, a base64 ed25519 signature of it by the key in
+// release_key.pub. Once a key is embedded, updates that can't be verified against
+// it are not installed.
+const (
+	checksumsAsset          = "checksums.txt"
+	checksumsSignatureAsset = "checksums.txt.sig"
+)
+
+//go:embed release_key.pub
+var releaseKeyFile string
+
+// maxChecksumsSize caps the size of checksums.txt and its signature.
+const maxChecksumsSize = 1 << 20
+
+// errNoReleaseKey is returned by releasePublicKey when release_key.pub holds no key.
+var errNoReleaseKey = errors.New("this build has no release signing key")
+
+// releasePublicKey parses the embedded release key.
+func releasePublicKey() (ed25519.PublicKey, error) {
+	for _, line := range strings.Split(releaseKeyFile, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, errors.New("the built-in release key is not a base64 ed25519 public key")
+		}
+		return ed25519.PublicKey(raw), nil
+	}
+	return nil, errNoReleaseKey
+}
+
+// verifyUpdate checks the downloaded zipPath, the release asset assetName, against
+// the release's signed checksums.txt. Builds without a release key skip the check
+// with a warning.
+func verifyUpdate(ctx context.Context, assets []releaseAsset, assetName, zipPath string) error {
+	pub, err := releasePublicKey()
+	if errors.Is(err, errNoReleaseKey) {
+		fmt.Println("Warning: this build has no release signing key; installing the update without verifying it")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var checksumsURL, signatureURL string
+	for _, asset := range assets {
+		switch asset.Name {
+		case checksumsAsset:
+			checksumsURL = asset.DownloadURL
+		case checksumsSignatureAsset:
+			signatureURL = asset.DownloadURL
+		}
+	}
+	if checksumsURL == "" || signatureURL == "" {
+		return fmt.Errorf("the release has no %s and %s", checksumsAsset, checksumsSignatureAsset)
+	}
+	checksums, err := fetchSmall(ctx, checksumsURL)
+	if err != nil {
+		return fmt.Errorf("fetching %s: %v", checksumsAsset, err)
+	}
+	signature, err := fetchSmall(ctx, signatureURL)
+	if err != nil {
+		return fmt.Errorf("fetching %s: %v", checksumsSignatureAsset, err)
+	}
+	return verifyChecksums(checksums, signature, pub, assetName, zipPath)
+}
+
+// verifyChecksums checks that signature is pub's signature of checksums, and that
+// checksums lists the SHA-256 of the file at path for name.
+func verifyChecksums(checksums, signature []byte, pub ed25519.PublicKey, name, path string) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("%s is not a base64 ed25519 signature", checksumsSignatureAsset)
+	}
+	if !ed25519.Verify(pub, checksums, sig) {
+		return fmt.Errorf("%s is not signed by the release key", checksumsAsset)
+	}
+
+	want := ""
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && strings.TrimPrefix(fields[1], "*") == name {
+			want = strings.ToLower(fields[0])
+			break
+		}
+	}
+	if want == "" {
+		return fmt.Errorf("%s has no checksum for %s", checksumsAsset, name)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("%s has SHA-256 %s, but the signed checksum is %s", name, got, want)
+	}
+	return nil
+}
+
+// fetchSmall downloads a small release asset such as checksums.txt.
+func fetchSmall(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxChecksumsSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxChecksumsSize {
+		return nil, fmt.Errorf("GET %s: larger than %d bytes", url, maxChecksumsSize)
+	}
+	return data, nil
+}
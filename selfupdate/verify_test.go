@@ -0,0 +1,76 @@
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyChecksums(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPriv, _ := ed25519.GenerateKey(nil)
+
+	zip := filepath.Join(t.TempDir(), "update.zip")
+	content := []byte("launcher release")
+	if err := os.WriteFile(zip, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	checksums := []byte(hex.EncodeToString(sum[:]) + "  Launcher-1.0.0-windows.zip\n" +
+		strings.Repeat("0", 64) + "  Launcher-1.0.0-macos-arm64.zip\n")
+	sign := func(key ed25519.PrivateKey, data []byte) []byte {
+		return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)) + "\n")
+	}
+
+	if err := verifyChecksums(checksums, sign(priv, checksums), pub, "Launcher-1.0.0-windows.zip", zip); err != nil {
+		t.Errorf("valid update: %v", err)
+	}
+	for name, tc := range map[string]struct {
+		signature []byte
+		asset     string
+	}{
+		"wrong key":        {sign(otherPriv, checksums), "Launcher-1.0.0-windows.zip"},
+		"garbage":          {[]byte("not a signature"), "Launcher-1.0.0-windows.zip"},
+		"checksum differs": {sign(priv, checksums), "Launcher-1.0.0-macos-arm64.zip"},
+		"not listed":       {sign(priv, checksums), "Launcher-1.0.0-linux.zip"},
+	} {
+		if err := verifyChecksums(checksums, tc.signature, pub, tc.asset, zip); err == nil {
+			t.Errorf("%s: verified", name)
+		}
+	}
+}
+
+func TestEmbeddedReleaseKey(t *testing.T) {
+	if _, err := releasePublicKey(); err != nil && !errors.Is(err, errNoReleaseKey) {
+		t.Fatalf("embedded release_key.pub: %v", err)
+	}
+}
+
+func TestReleasePublicKey(t *testing.T) {
+	saved := releaseKeyFile
+	defer func() { releaseKeyFile = saved }()
+
+	releaseKeyFile = "# comment only\n"
+	if _, err := releasePublicKey(); !errors.Is(err, errNoReleaseKey) {
+		t.Errorf("key file without a key: got %v, want errNoReleaseKey", err)
+	}
+	releaseKeyFile = "not-a-key\n"
+	if _, err := releasePublicKey(); err == nil || errors.Is(err, errNoReleaseKey) {
+		t.Errorf("malformed key: got %v", err)
+	}
+	pub, _, _ := ed25519.GenerateKey(nil)
+	releaseKeyFile = "# comment\n" + base64.StdEncoding.EncodeToString(pub) + "\n"
+	got, err := releasePublicKey()
+	if err != nil || !got.Equal(pub) {
+		t.Errorf("releasePublicKey = %v, %v", got, err)
+	}
+}
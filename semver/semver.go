@@ -0,0 +1,190 @@
+// Package semver compares the version strings of extensions and launcher releases.
+// It follows Semantic Versioning 2.0.0 precedence, but accepts any number of
+// numeric components (extension manifests use up to four), an optional leading
+// "v", and tags that aren't quite semver, such as "v2.0.0-rc1" or "1.2".
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed version string.
+type Version struct {
+	// Core holds the dot-separated numeric components, e.g. [1 2 0].
+	Core []int
+	// Prerelease holds the dot-separated identifiers after "-", e.g. ["beta", "3"].
+	Prerelease []string
+	// Build is the metadata after "+". It doesn't affect precedence.
+	Build string
+}
+
+// Parse splits v into its components. It never fails: a component that isn't a
+// number counts as 0, as it always has for the launcher's version checks.
+func Parse(v string) Version {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	var parsed Version
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v, parsed.Build = v[:i], v[i+1:]
+	}
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		if pre := v[i+1:]; pre != "" {
+			parsed.Prerelease = strings.Split(pre, ".")
+		}
+		v = v[:i]
+	}
+	for _, part := range strings.Split(v, ".") {
+		n, _ := strconv.Atoi(part)
+		parsed.Core = append(parsed.Core, n)
+	}
+	return parsed
+}
+
+// IsPrerelease reports whether v has a prerelease part.
+func IsPrerelease(v string) bool {
+	return len(Parse(v).Prerelease) > 0
+}
+
+// Core returns v without its prerelease and build parts or leading "v", which is
+// what an extension's manifest version holds.
+func Core(v string) string {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	return v
+}
+
+// Compare returns -1, 0 or 1 depending on whether a is older than, the same as or
+// newer than b. Missing core components count as 0, so 1.2 equals 1.2.0, and a
+// prerelease is older than the release it precedes.
+func Compare(a, b string) int {
+	va, vb := Parse(a), Parse(b)
+	for i := 0; i < len(va.Core) || i < len(vb.Core); i++ {
+		if c := compareInts(component(va.Core, i), component(vb.Core, i)); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(va.Prerelease) == 0 && len(vb.Prerelease) == 0:
+		return 0
+	case len(va.Prerelease) == 0:
+		return 1
+	case len(vb.Prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(va.Prerelease) && i < len(vb.Prerelease); i++ {
+		if c := compareIdentifiers(va.Prerelease[i], vb.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(va.Prerelease), len(vb.Prerelease))
+}
+
+func component(core []int, i int) int {
+	if i < len(core) {
+		return core[i]
+	}
+	return 0
+}
+
+// compareIdentifiers orders prerelease identifiers: numeric ones numerically and
+// below alphanumeric ones, which compare by their leading text and then by any
+// trailing number, so "rc2" < "rc10".
+func compareIdentifiers(a, b string) int {
+	na, aNumeric := number(a)
+	nb, bNumeric := number(b)
+	switch {
+	case aNumeric && bNumeric:
+		return compareInts(na, nb)
+	case aNumeric:
+		return -1
+	case bNumeric:
+		return 1
+	}
+	ta, sa := splitTrailingNumber(a)
+	tb, sb := splitTrailingNumber(b)
+	if ta != tb || sa == "" || sb == "" {
+		return strings.Compare(a, b)
+	}
+	na, _ = number(sa)
+	nb, _ = number(sb)
+	return compareInts(na, nb)
+}
+
+func number(s string) (int, bool) {
+	if s == "" {
+		return 0, false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
+
+// splitTrailingNumber splits "rc10" into "rc" and "10".
+func splitTrailingNumber(s string) (string, string) {
+	i := len(s)
+	for i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+		i--
+	}
+	return s[:i], s[i:]
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Satisfies reports whether v is in the range constraint: comparisons such as
+// ">=0.12.0" or "<1.0" separated by spaces, all of which must hold, with "||"
+// between alternatives. A version without an operator must match exactly.
+func Satisfies(v, constraint string) (bool, error) {
+	if strings.TrimSpace(constraint) == "" {
+		return false, fmt.Errorf("empty version range")
+	}
+	satisfied := false
+	for _, alternative := range strings.Split(constraint, "||") {
+		fields := strings.Fields(alternative)
+		if len(fields) == 0 {
+			return false, fmt.Errorf("invalid version range %q", constraint)
+		}
+		all := true
+		for _, field := range fields {
+			bound := strings.TrimLeft(field, "<>=")
+			op := field[:len(field)-len(bound)]
+			if digits := strings.TrimPrefix(bound, "v"); digits == "" || digits[0] < '0' || digits[0] > '9' {
+				return false, fmt.Errorf("invalid version range %q", constraint)
+			}
+			c := Compare(v, bound)
+			var ok bool
+			switch op {
+			case "", "=":
+				ok = c == 0
+			case ">":
+				ok = c > 0
+			case ">=":
+				ok = c >= 0
+			case "<":
+				ok = c < 0
+			case "<=":
+				ok = c <= 0
+			default:
+				return false, fmt.Errorf("invalid operator %q in version range %q", op, constraint)
+			}
+			all = all && ok
+		}
+		satisfied = satisfied || all
+	}
+	return satisfied, nil
+}
@@ -0,0 +1,80 @@
+package semver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"v1.2.0", "1.2", 0},
+		{"1.2.3.4", "1.2.3", 1},
+		{"1.10.0", "1.9.0", 1},
+		{"", "0.0.1", -1},
+		{"1.2.0-beta.3", "1.2.0", -1},
+		{"1.2.0-beta.3", "1.1.9", 1},
+		{"v2.0.0-rc1", "2.0.0", -1},
+		{"2.0.0-rc2", "2.0.0-rc10", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-alpha.beta", "1.0.0-beta", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-beta.11", "1.0.0-rc.1", -1},
+		{"1.0.0+build.5", "1.0.0+build.7", 0},
+		{"1.0.0-rc.1+build", "1.0.0-rc.1", 0},
+	} {
+		if got := Compare(tc.a, tc.b); got != tc.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := Compare(tc.b, tc.a); got != -tc.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", tc.b, tc.a, got, -tc.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	got := Parse("v1.2.0-beta.3+abc")
+	want := Version{Core: []int{1, 2, 0}, Prerelease: []string{"beta", "3"}, Build: "abc"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse = %+v, want %+v", got, want)
+	}
+	if Core("v1.2.0-beta.3+abc") != "1.2.0" {
+		t.Errorf("Core = %q, want 1.2.0", Core("v1.2.0-beta.3+abc"))
+	}
+	if !IsPrerelease("2.0.0-rc1") || IsPrerelease("2.0.0+build") {
+		t.Errorf("IsPrerelease is wrong")
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	for _, tc := range []struct {
+		v, constraint string
+		want          bool
+	}{
+		{"0.13.2", ">=0.12.0 <0.14.0", true},
+		{"0.14.0", ">=0.12.0 <0.14.0", false},
+		{"0.11.9", ">=0.12", false},
+		{"1.0.0", "<0.14 || >=1.0", true},
+		{"0.14.1", "<0.14 || >=1.0", false},
+		{"0.13.0", "0.13", true},
+		{"0.13.0", "=0.13.1", false},
+		{"1.0.0-beta.1", "<1.0.0", true},
+		{"0.13.0", "<=0.13.0 >0.12", true},
+	} {
+		got, err := Satisfies(tc.v, tc.constraint)
+		if err != nil {
+			t.Errorf("Satisfies(%q, %q): %v", tc.v, tc.constraint, err)
+		} else if got != tc.want {
+			t.Errorf("Satisfies(%q, %q) = %v, want %v", tc.v, tc.constraint, got, tc.want)
+		}
+	}
+	for _, constraint := range []string{"", ">=", "=>1.0", "1.0 ||", "~1.2"} {
+		if _, err := Satisfies("1.0", constraint); err == nil {
+			t.Errorf("Satisfies(%q) accepted an invalid range", constraint)
+		}
+	}
+}
@@ -2,11 +2,19 @@
 
 package utils
 
+import "os"
+
 // IsAdmin returns true on non-Windows platforms (elevation not needed).
 func IsAdmin() bool {
 	return true
 }
 
+// IsElevated reports whether the process runs as root, and so must not trust files
+// the user can write.
+func IsElevated() bool {
+	return os.Geteuid() == 0
+}
+
 // RelaunchAsAdmin is a no-op on non-Windows platforms.
 func RelaunchAsAdmin() error {
 	return nil
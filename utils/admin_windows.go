@@ -38,6 +38,12 @@ type shellExecuteInfo struct {
 	hProcess     uintptr
 }
 
+// IsElevated reports whether the process runs with administrator privileges, and so
+// must not trust files the user can write.
+func IsElevated() bool {
+	return IsAdmin()
+}
+
 // IsAdmin checks if the current process is running with administrator privileges.
 func IsAdmin() bool {
 	f, err := os.Open("\\\\.\\PHYSICALDRIVE0")
@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractOptions controls ExtractZip.
+type ExtractOptions struct {
+	// Prefix selects the entries under a directory of the archive (e.g. "app/") and
+	// strips it; entries outside it are skipped.
+	Prefix string
+	// DecodeOPC percent-decodes entry names. MSIX part names follow OPC, which
+	// encodes reserved characters (e.g. "@" -> "%40").
+	DecodeOPC bool
+	// Symlinks restores entries stored with the Unix symlink mode as symlinks. Their
+	// targets must stay inside the destination. When unset they are extracted as
+	// regular files holding the target path.
+	Symlinks bool
+	// MaxSize limits the total number of bytes extracted; 0 means no limit.
+	MaxSize int64
+	// OnProgress, if set, is called after each entry with the number of entries
+	// processed and the total.
+	OnProgress func(done, total int)
+}
+
+// ErrArchiveTooLarge is returned by ExtractZip when an archive exceeds MaxSize.
+var ErrArchiveTooLarge = errors.New("archive exceeds the size limit")
+
+// ExtractZip extracts zipPath into destDir. Entries that would land outside destDir
+// (absolute paths, "..", or symlinks pointing out) fail the extraction, as do read
+// and write errors. File modes are taken from the archive, and zero-byte entries
+// whose name ends in a slash or backslash are treated as directories, which is how
+// PowerShell's Compress-Archive stores them.
+func ExtractZip(ctx context.Context, zipPath, destDir string, opts ExtractOptions) error {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return fmt.Errorf("opening archive: %w", err)
+	}
+	defer zr.Close()
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	// Symlinks are created after everything else, so no entry is ever written
+	// through one.
+	type pendingLink struct {
+		f      *zip.File
+		target string
+	}
+	var links []pendingLink
+
+	var written int64
+	for i, f := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if opts.OnProgress != nil {
+			opts.OnProgress(i+1, len(zr.File))
+		}
+
+		name := strings.ReplaceAll(f.Name, "\\", "/")
+		isDir := f.FileInfo().IsDir() || (f.UncompressedSize64 == 0 && strings.HasSuffix(name, "/"))
+
+		if opts.Prefix != "" {
+			if !strings.HasPrefix(name, opts.Prefix) {
+				continue
+			}
+			name = strings.TrimPrefix(name, opts.Prefix)
+		}
+		if opts.DecodeOPC {
+			if decoded, err := url.PathUnescape(name); err == nil {
+				name = decoded
+			}
+		}
+		name = strings.TrimRight(name, "/")
+		if name == "" {
+			continue
+		}
+
+		rel := filepath.FromSlash(name)
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("archive entry %q escapes the destination", f.Name)
+		}
+		target := filepath.Join(destDir, rel)
+
+		if isDir {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Skip if path already exists as a directory (created by an earlier entry)
+		if info, err := os.Lstat(target); err == nil && info.IsDir() {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		if opts.Symlinks && f.Mode()&os.ModeSymlink != 0 {
+			links = append(links, pendingLink{f, target})
+			continue
+		}
+
+		n, err := extractFile(f, target, opts.MaxSize-written, opts.MaxSize > 0)
+		written += n
+		if err != nil {
+			if errors.Is(err, ErrArchiveTooLarge) {
+				return err
+			}
+			return fmt.Errorf("extracting %s: %w", f.Name, err)
+		}
+	}
+
+	if len(links) == 0 {
+		return nil
+	}
+	root, err := filepath.EvalSymlinks(destDir)
+	if err != nil {
+		return err
+	}
+	for _, l := range links {
+		if err := extractSymlink(l.f, root, l.target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractFile writes one entry to target, reading at most limit bytes when limited.
+func extractFile(f *zip.File, target string, limit int64, limited bool) (int64, error) {
+	mode := f.Mode().Perm() | 0600
+	if f.Mode().Perm() == 0 {
+		mode = 0644
+	}
+
+	src, err := f.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	os.Remove(target) // replace symlinks rather than writing through them
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	if limited {
+		n, err = io.Copy(dst, io.LimitReader(src, limit+1))
+		if err == nil && n > limit {
+			err = ErrArchiveTooLarge
+		}
+	} else {
+		n, err = io.Copy(dst, src)
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+// extractSymlink creates the symlink stored in f at target, provided it resolves to
+// a path inside root (the destination with its own symlinks resolved).
+func extractSymlink(f *zip.File, root, target string) error {
+	src, err := f.Open()
+	if err != nil {
+		return err
+	}
+	linkTarget, err := io.ReadAll(io.LimitReader(src, 4096))
+	src.Close()
+	if err != nil {
+		return fmt.Errorf("extracting %s: %w", f.Name, err)
+	}
+
+	link := string(linkTarget)
+	parent, err := filepath.EvalSymlinks(filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, filepath.Join(parent, filepath.FromSlash(link)))
+	if path.IsAbs(link) || filepath.IsAbs(link) || err != nil || (rel != "." && !filepath.IsLocal(rel)) {
+		return fmt.Errorf("archive symlink %q -> %q escapes the destination", f.Name, link)
+	}
+	os.Remove(target)
+	if err := os.Symlink(link, target); err != nil {
+		return fmt.Errorf("creating symlink %s: %w", f.Name, err)
+	}
+	return nil
+}
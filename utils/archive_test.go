@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+type zipEntry struct {
+	name string
+	body string
+	mode os.FileMode
+}
+
+func writeZip(t *testing.T, entries []zipEntry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.zip")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.mode != 0 {
+			h.SetMode(e.mode)
+		}
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e.body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	return path
+}
+
+func TestExtractZip(t *testing.T) {
+	zipPath := writeZip(t, []zipEntry{
+		{name: "AppxManifest.xml", body: "skipped"},
+		{name: `app\empty\`}, // Compress-Archive style directory entry
+		{name: "app/node_modules/%40ant/pkg/index.js", body: "decoded"},
+		{name: "app/bin/tool", body: "#!/bin/sh\n", mode: 0755},
+	})
+	dest := t.TempDir()
+	var progress int
+	err := ExtractZip(context.Background(), zipPath, dest, ExtractOptions{
+		Prefix:     "app/",
+		DecodeOPC:  true,
+		OnProgress: func(done, total int) { progress = done },
+	})
+	if err != nil {
+		t.Fatalf("ExtractZip: %v", err)
+	}
+	if progress != 4 {
+		t.Errorf("progress reached %d, want 4", progress)
+	}
+
+	if _, err := os.Stat(filepath.Join(dest, "AppxManifest.xml")); !os.IsNotExist(err) {
+		t.Errorf("entry outside the prefix was extracted")
+	}
+	if info, err := os.Stat(filepath.Join(dest, "empty")); err != nil || !info.IsDir() {
+		t.Errorf("backslash directory entry was not created as a directory")
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "node_modules", "@ant", "pkg", "index.js")); err != nil || string(data) != "decoded" {
+		t.Errorf("OPC-encoded entry: %q, %v", data, err)
+	}
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(filepath.Join(dest, "bin", "tool")); err != nil || info.Mode().Perm() != 0755 {
+			t.Errorf("mode not preserved: %v, %v", info.Mode(), err)
+		}
+	}
+}
+
+func TestExtractZipRejectsEscapes(t *testing.T) {
+	for _, name := range []string{"../evil.txt", "a/../../evil.txt", "/abs.txt", `..\evil.txt`} {
+		zipPath := writeZip(t, []zipEntry{{name: name, body: "x"}})
+		parent := t.TempDir()
+		dest := filepath.Join(parent, "dest")
+		err := ExtractZip(context.Background(), zipPath, dest, ExtractOptions{})
+		if err == nil || !strings.Contains(err.Error(), "escapes") {
+			t.Errorf("%s: got %v, want an escape error", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(parent, "evil.txt")); err == nil {
+			t.Errorf("%s: file was written outside the destination", name)
+		}
+	}
+}
+
+func TestExtractZipSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need extra privileges on Windows")
+	}
+
+	ok := writeZip(t, []zipEntry{
+		{name: "Versions/A/lib", body: "library"},
+		{name: "Versions/Current", body: "A", mode: os.ModeSymlink | 0755},
+		{name: "lib", body: "Versions/Current/lib", mode: os.ModeSymlink | 0755},
+	})
+	dest := t.TempDir()
+	if err := ExtractZip(context.Background(), ok, dest, ExtractOptions{Symlinks: true}); err != nil {
+		t.Fatalf("ExtractZip: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "lib")); err != nil || string(data) != "library" {
+		t.Errorf("reading through symlinks: %q, %v", data, err)
+	}
+
+	// "up" points at the destination itself, so "up/out" -> "../x" resolves
+	// outside it even though it looks contained.
+	for _, entries := range [][]zipEntry{
+		{{name: "out", body: "../outside", mode: os.ModeSymlink | 0755}},
+		{{name: "abs", body: "/etc/passwd", mode: os.ModeSymlink | 0755}},
+		{
+			{name: "up", body: ".", mode: os.ModeSymlink | 0755},
+			{name: "up/out", body: "../x", mode: os.ModeSymlink | 0755},
+		},
+	} {
+		zipPath := writeZip(t, entries)
+		err := ExtractZip(context.Background(), zipPath, t.TempDir(), ExtractOptions{Symlinks: true})
+		if err == nil || !strings.Contains(err.Error(), "escapes") {
+			t.Errorf("%s: got %v, want an escape error", entries[len(entries)-1].name, err)
+		}
+	}
+}
+
+func TestExtractZipMaxSize(t *testing.T) {
+	zipPath := writeZip(t, []zipEntry{
+		{name: "a", body: strings.Repeat("a", 600)},
+		{name: "b", body: strings.Repeat("b", 600)},
+	})
+	err := ExtractZip(context.Background(), zipPath, t.TempDir(), ExtractOptions{MaxSize: 1000})
+	if !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("got %v, want ErrArchiveTooLarge", err)
+	}
+	if err := ExtractZip(context.Background(), zipPath, t.TempDir(), ExtractOptions{MaxSize: 1200}); err != nil {
+		t.Errorf("archive at the limit: %v", err)
+	}
+}